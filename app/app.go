@@ -12,7 +12,13 @@ import (
 	"syscall"
 )
 
+// main 未指定子命令时按配置文件启动节点
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := cliCommands[os.Args[1]]; ok {
+			os.Exit(runCommand(os.Args[1], command, os.Args[2:]))
+		}
+	}
 	configFilename := flag.String("c", config.DefaultConfigFilename, "config file")
 	flag.Parse()
 	cfg, err := config.LoadConfig(*configFilename)
@@ -22,31 +28,88 @@ func main() {
 	}
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
-	startApp(ctx, cfg)
+	startApp(ctx, *configFilename, cfg)
 }
-func startApp(ctx context.Context, cfg *config.Config) {
-	node, err := impl.CreateNode(cfg.Logger(), &cfg.Ctrl, silly_ctrl.NewBasicValidator(cfg.Apps), impl.DefaultServices())
+func startApp(ctx context.Context, filename string, cfg *config.Config) {
+	services := impl.DefaultServices().Use(
+		silly_ctrl.RecoveryInterceptor(cfg.Logger()),
+		silly_ctrl.AccessLogInterceptor(cfg.Logger()),
+		silly_ctrl.MetricsInterceptor(silly_ctrl.DefaultMetrics),
+	)
+	validator, appsFile, err := makeValidator(cfg)
+	if err != nil {
+		cfg.Logger().Error("create validator failed", "err", err)
+		return
+	}
+	node, err := impl.CreateNode(cfg.Logger(), &cfg.Ctrl, validator, services)
 	if err != nil {
 		cfg.Logger().Error("create node failed", "err", err)
 		return
 	}
-	var wc []silly_ctrl.WorkerCreator
-	if len(cfg.Apps) > 0 {
+	// 转发与远程连接可在运行时添加,未配置时也需运行
+	forwards := &forwardWorker{cfg: cfg, node: node}
+	remotes := &remoteWorker{cfg: cfg, node: node}
+	reload := &reloader{
+		filename: filename,
+		current:  cfg,
+		node:     node,
+		forwards: forwards,
+		remotes:  remotes,
+	}
+	if appsFile == nil {
+		reload.apps, _ = validator.(silly_ctrl.AppUpdater)
+	}
+	wc := []silly_ctrl.WorkerCreator{func(ctx context.Context) (silly_ctrl.Worker, error) {
+		return forwards, nil
+	}, func(ctx context.Context) (silly_ctrl.Worker, error) {
+		return remotes, nil
+	}, func(ctx context.Context) (silly_ctrl.Worker, error) {
+		return reload, nil
+	}}
+	if cfg.Listening() {
 		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
 			return makeListenWorker(node, cfg)
 		})
 	}
-	if len(cfg.Remote) > 0 {
+	if appsFile != nil {
+		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
+			return &appsWatcher{cfg: cfg, node: node, file: appsFile}, nil
+		})
+	}
+	if crl := cfg.RevocationList(); crl != nil {
+		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
+			return &crlWatcher{cfg: cfg, node: node, crl: crl}, nil
+		})
+	}
+	if cfg.Control != "" {
+		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
+			return &controlWorker{cfg: cfg, node: node, forwards: forwards, remotes: remotes, reload: reload.Reload}, nil
+		})
+	}
+	if cfg.Metrics != "" {
+		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
+			return &metricsWorker{cfg: cfg, node: node}, nil
+		})
+	}
+	if len(cfg.ReverseForward) > 0 {
+		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
+			return &reverseWorker{
+				cfg:  cfg,
+				node: node,
+			}, nil
+		})
+	}
+	if len(cfg.Socks) > 0 {
 		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
-			return &remoteWorker{
+			return &socksWorker{
 				cfg:  cfg,
 				node: node,
 			}, nil
 		})
 	}
-	if len(cfg.Forward) > 0 {
+	if len(cfg.HTTPProxy) > 0 {
 		wc = append(wc, func(ctx context.Context) (silly_ctrl.Worker, error) {
-			return &forwardWorker{
+			return &httpProxyWorker{
 				cfg:  cfg,
 				node: node,
 			}, nil
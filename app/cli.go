@@ -0,0 +1,594 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"github.com/irealing/silly-ctrl/impl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+type cliCommand func(ctx context.Context, args []string) error
+
+// cliCommands 子命令,经控制 socket 访问运行中的节点,或以 App 身份直连对端;pki 管理本地 CA
+var cliCommands = map[string]cliCommand{
+	"sessions": sessionsCommand,
+	"ping":     pingCommand,
+	"exec":     execCommand,
+	"forward":  forwardCommand,
+	"cp":       cpCommand,
+	"kick":     kickCommand,
+	"routes":   routesCommand,
+	"forwards": forwardsCommand,
+	"reload":   reloadCommand,
+	"remotes":  remotesCommand,
+	"pki":      pkiCommand,
+}
+
+// exitCode 子命令以指定退出码结束
+type exitCode int
+
+func (code exitCode) Error() string {
+	return "exit status " + strconv.Itoa(int(code))
+}
+
+func runCommand(name string, command cliCommand, args []string) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	err := command(ctx, args)
+	var code exitCode
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	case errors.As(err, &code):
+		return int(code)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	return 1
+}
+
+// directSession 直连模式下代表对端的会话参数
+const directSession = "-"
+
+// cliTarget 子命令访问会话的方式,指定 -connect 时以 App 身份直连对端,会话参数须为 -
+type cliTarget struct {
+	socket    string
+	config    string
+	connect   string
+	accessKey string
+	secret    string
+	insecure  bool
+	ca        string
+	pins      string
+	cfg       *config.Config
+}
+
+func newFlagSet(name, usage string, target *cliTarget) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "usage: silly-ctrl %s [flags] %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&target.socket, "s", "", "control socket of the running node (default from -c)")
+	fs.StringVar(&target.config, "c", "", "config file providing the control socket and TLS settings")
+	fs.StringVar(&target.connect, "connect", "", "connect directly to `address` as an App instead of using the control socket")
+	fs.StringVar(&target.accessKey, "ak", "", "AccessKey for -connect")
+	fs.StringVar(&target.secret, "sk", "", "Secret for -connect")
+	fs.BoolVar(&target.insecure, "insecure", false, "skip server certificate verification for -connect without -c")
+	fs.StringVar(&target.ca, "ca", "", "CA file verifying the server certificate for -connect")
+	fs.StringVar(&target.pins, "pin", "", "comma separated SPKI SHA-256 pins of the server certificate for -connect")
+	return fs
+}
+
+func (target *cliTarget) load() error {
+	if target.config == "" || target.cfg != nil {
+		return nil
+	}
+	cfg, err := config.ReadConfig(target.config)
+	if err != nil {
+		return err
+	}
+	target.cfg = cfg
+	return nil
+}
+
+// control 管理类子命令仅支持控制 socket
+func (target *cliTarget) control() (*silly_ctrl.ControlClient, error) {
+	if target.connect != "" {
+		return nil, fmt.Errorf("%w: -connect is not supported", silly_ctrl.BadParamError)
+	}
+	if err := target.load(); err != nil {
+		return nil, err
+	}
+	path := target.socket
+	if path == "" && target.cfg != nil {
+		path = target.cfg.Control
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%w: control socket not configured, use -s or -c", silly_ctrl.BadParamError)
+	}
+	return silly_ctrl.NewControlClient(path), nil
+}
+
+// session 打开 id 对应的会话,返回的函数用于释放直连的连接
+func (target *cliTarget) session(ctx context.Context, id string) (silly_ctrl.Session, func(), error) {
+	if err := target.load(); err != nil {
+		return nil, nil, err
+	}
+	if target.connect == "" {
+		client, err := target.control()
+		if err != nil {
+			return nil, nil, err
+		}
+		sess, err := client.Session(ctx, id)
+		return sess, func() {}, err
+	}
+	if id != directSession {
+		return nil, nil, fmt.Errorf("%w: session must be %s with -connect", silly_ctrl.BadParamError, directSession)
+	}
+	return target.dial(ctx)
+}
+
+// dial 以 App 身份连接对端,对端仅可向本端发送 ECHO 与 ROUTE 命令
+func (target *cliTarget) dial(ctx context.Context) (silly_ctrl.Session, func(), error) {
+	if target.accessKey == "" {
+		return nil, nil, fmt.Errorf("%w: -ak is required with -connect", silly_ctrl.BadParamError)
+	}
+	logger, tlsConfig := slog.Default(), &tls.Config{InsecureSkipVerify: target.insecure}
+	if target.cfg != nil {
+		if err := target.cfg.LoadTLS(); err != nil {
+			return nil, nil, err
+		}
+		logger, tlsConfig = target.cfg.Logger(), target.cfg.TLSConfig()
+	}
+	remote := &config.Remote{Address: target.connect, CA: target.ca}
+	if target.pins != "" {
+		remote.Pins = strings.Split(target.pins, ",")
+	}
+	tlsConfig, err := remote.TLSConfig(tlsConfig, remote.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctrlCfg := silly_ctrl.DefaultConfig()
+	ctrlCfg.LocalAddress = ":0"
+	node, err := impl.CreateNode(logger, ctrlCfg, silly_ctrl.NewBasicValidator(nil), impl.DefaultServices())
+	if err != nil {
+		return nil, nil, err
+	}
+	app := &silly_ctrl.App{
+		AccessKey: target.accessKey,
+		Secret:    target.secret,
+		Policy:    &silly_ctrl.Policy{Commands: []string{packet.CommandType_ECHO.String(), packet.CommandType_ROUTE.String()}},
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- node.Connect(ctx, target.connect, app, tlsConfig)
+	}()
+	release := func() {
+		cancel()
+		<-done
+	}
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for {
+		if sessions := node.Manager().List(); len(sessions) > 0 {
+			return sessions[0], release, nil
+		}
+		select {
+		case err = <-done:
+			cancel()
+			if err == nil {
+				err = silly_ctrl.ApplicationOver
+			}
+			return nil, nil, err
+		case <-ctx.Done():
+			release()
+			return nil, nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func sessionsCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("sessions", "", target)
+	asJSON := fs.Bool("json", false, "print sessions as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var infos []*silly_ctrl.SessionInfo
+	if target.connect != "" {
+		sess, release, err := target.session(ctx, directSession)
+		if err != nil {
+			return err
+		}
+		defer release()
+		infos = append(infos, silly_ctrl.NewSessionInfo(sess))
+	} else {
+		client, err := target.control()
+		if err != nil {
+			return err
+		}
+		if infos, err = client.Sessions(ctx); err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(infos)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tAPP\tDIRECTION\tREMOTE\tHOSTNAME\tCONNECTED\tSTREAMS\tRTT")
+	for _, info := range infos {
+		direction := "in"
+		if info.IsRemote {
+			direction = "out"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			info.ID, info.AccessKey, direction, info.RemoteAddr, info.Info.GetHostname(),
+			time.Since(info.ConnectedAt).Truncate(time.Second), info.Streams, info.Stats.RTT.Round(time.Microsecond))
+	}
+	return w.Flush()
+}
+
+func pingCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("ping", "<session>", target)
+	count := fs.Int("n", 4, "number of probes")
+	interval := fs.Duration("i", time.Second, "interval between probes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *count < 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	sess, release, err := target.session(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer release()
+	samples, err := silly_ctrl.Ping(ctx, sess, *count, *interval)
+	var total, least, most time.Duration
+	for seq, rtt := range samples {
+		fmt.Printf("seq=%d time=%s\n", seq, rtt)
+		total += rtt
+		if seq == 0 || rtt < least {
+			least = rtt
+		}
+		most = max(most, rtt)
+	}
+	if len(samples) > 0 {
+		fmt.Printf("%d probes, min/avg/max = %s/%s/%s\n", len(samples), least, total/time.Duration(len(samples)), most)
+	}
+	return err
+}
+
+func execCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("exec", "<session> [--] <program> [args...]", target)
+	dir := fs.String("dir", "", "working directory on the remote side")
+	env := fs.String("env", "", "extra environment variables, separated by ;")
+	noStdin := fs.Bool("n", false, "do not forward stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	rest := fs.Args()
+	if len(rest) > 1 && rest[1] == "--" {
+		rest = append(rest[:1], rest[2:]...)
+	}
+	if len(rest) < 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	sess, release, err := target.session(ctx, rest[0])
+	if err != nil {
+		return err
+	}
+	defer release()
+	cmd := packet.ExecCommand(rest[1:]...)
+	if *dir != "" {
+		cmd.SetParam("dir", *dir)
+	}
+	if *env != "" {
+		cmd.SetParam("env", *env)
+	}
+	var stdin io.Reader = os.Stdin
+	if *noStdin {
+		stdin = nil
+	}
+	result, err := silly_ctrl.RunCommand(ctx, sess, cmd, stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	if result.ExitCode != 0 {
+		return exitCode(result.ExitCode)
+	}
+	return nil
+}
+
+func forwardCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("forward", "<session> <local address> <remote address>", target)
+	network := fs.String("network", "tcp", "tcp or udp")
+	idle := fs.Duration("idle", time.Minute, "idle timeout of udp flows")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	sess, release, err := target.session(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer release()
+	local, remote := fs.Arg(1), fs.Arg(2)
+	if silly_ctrl.IsPacketNetwork(*network) {
+		conn, err := net.ListenPacket(*network, local)
+		if err != nil {
+			return err
+		}
+		slog.Info("forward packets", "local", conn.LocalAddr(), "remote", remote, "session", sess.ID())
+		return silly_ctrl.ServePacketConn(ctx, conn, func(ctx context.Context, pipe silly_ctrl.PacketPipe, addr net.Addr) {
+			cmd := packet.ProxyCommand(*network, remote).SetParam("idle", idle.String())
+			err := silly_ctrl.PacketTunnel(ctx, sess, cmd, func(ctx context.Context, tunnel silly_ctrl.PacketPipe) error {
+				return silly_ctrl.RelayPackets(ctx, sess.App().AccessKey, pipe, tunnel, *idle)
+			})
+			if err != nil {
+				slog.Error("forward packet error", "source", addr, "err", err)
+			}
+		})
+	}
+	listener, err := net.Listen(*network, local)
+	if err != nil {
+		return err
+	}
+	slog.Info("forward", "local", listener.Addr(), "remote", remote, "session", sess.ID())
+	stop := context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+	})
+	defer stop()
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				_ = conn.Close()
+				wg.Done()
+			}()
+			err := sess.Exec(ctx, packet.ProxyCommand(*network, remote), func(ctx context.Context, _ *packet.Ret, _ silly_ctrl.Session, stream quic.Stream) error {
+				return silly_ctrl.RelayConn(ctx, sess.App().AccessKey, conn, conn, stream)
+			})
+			if err != nil {
+				slog.Error("forward error", "source", conn.RemoteAddr(), "err", err)
+			}
+		}()
+	}
+}
+
+func cpCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("cp", "<src> <dest>, one of which is <session>:<path>", target)
+	resume := fs.Bool("resume", false, "resume from existing .part files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	srcSession, src, srcRemote := splitRemotePath(fs.Arg(0))
+	destSession, dest, destRemote := splitRemotePath(fs.Arg(1))
+	if srcRemote == destRemote {
+		return fmt.Errorf("%w: exactly one of src and dest must be <session>:<path>", silly_ctrl.BadParamError)
+	}
+	id := srcSession
+	if destRemote {
+		id = destSession
+	}
+	sess, release, err := target.session(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer release()
+	var stat *silly_ctrl.TransferStat
+	if srcRemote {
+		stat, err = silly_ctrl.GetFile(ctx, sess, src, dest, *resume)
+	} else {
+		stat, err = silly_ctrl.PutFile(ctx, sess, src, dest, *resume)
+	}
+	if stat != nil {
+		fmt.Printf("%d files, %d dirs, %d bytes transferred, %d bytes resumed\n", stat.Files, stat.Dirs, stat.Bytes, stat.Resumed)
+	}
+	return err
+}
+
+// splitRemotePath 拆分 <session>:<path>,冒号前含路径分隔符时视为本地路径
+func splitRemotePath(arg string) (string, string, bool) {
+	session, path, ok := strings.Cut(arg, ":")
+	if !ok || session == "" || strings.ContainsAny(session, `/\`) {
+		return "", arg, false
+	}
+	return session, path, true
+}
+
+func kickCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("kick", "<session>", target)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	client, err := target.control()
+	if err != nil {
+		return err
+	}
+	info, err := client.Kick(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("session %s (%s) closed\n", info.ID, info.AccessKey)
+	return nil
+}
+
+func routesCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("routes", "", target)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := target.control()
+	if err != nil {
+		return err
+	}
+	routes, err := client.Routes(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "APP\tHOPS\tSESSION\tNODE\tEXPIRES")
+	for _, route := range routes {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", route.AccessKey, route.Hops, route.Session, route.Node, time.Until(route.ExpireAt).Truncate(time.Second))
+	}
+	return w.Flush()
+}
+
+func remotesCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("remotes", "", target)
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := target.control()
+	if err != nil {
+		return err
+	}
+	var remotes []remoteStatus
+	if err = client.Do(ctx, http.MethodGet, "/remotes", nil, nil, &remotes); err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(remotes)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tSTATE\tSINCE\tENDPOINT\tSESSION\tFAILURES\tLAST ERROR")
+	for _, remote := range remotes {
+		state := remote.State
+		if !remote.NextRetry.IsZero() {
+			state += " " + time.Until(remote.NextRetry).Round(time.Second).String()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", remote.ID, state, time.Since(remote.Since).Truncate(time.Second),
+			remote.Endpoint, remote.Session, remote.Failures, remote.LastError)
+	}
+	return w.Flush()
+}
+
+// forwardsCommand 管理运行中节点的转发,经此添加的转发不随配置重新加载
+func forwardsCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("forwards", "[add <local address> <remote address> | rm <id>]", target)
+	var fc config.Forward
+	var route string
+	var idle time.Duration
+	fs.StringVar(&fc.App, "app", "", "App to forward through, for add")
+	fs.StringVar(&fc.Via, "via", "", "session sending FORWARD, for add")
+	fs.StringVar(&route, "route", "", "comma separated multi-hop route, for add")
+	fs.StringVar(&fc.Network, "network", "tcp", "tcp or udp, for add")
+	fs.DurationVar(&idle, "idle", 0, "idle timeout of udp flows, for add")
+	fs.StringVar((*string)(&fc.Select), "select", "", "session select policy, for add")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := target.control()
+	if err != nil {
+		return err
+	}
+	switch {
+	case fs.NArg() == 3 && fs.Arg(0) == "add":
+		fc.LocalAddress, fc.RemoteAddress = fs.Arg(1), fs.Arg(2)
+		fc.IdleSeconds = int(idle / time.Second)
+		if route != "" {
+			fc.Route = strings.Split(route, ",")
+		}
+		var forward runningForward
+		if err = client.Do(ctx, http.MethodPost, "/forwards", nil, &fc, &forward); err != nil {
+			return err
+		}
+		fmt.Println(forward.ID)
+		return nil
+	case fs.NArg() == 2 && fs.Arg(0) == "rm":
+		return client.Do(ctx, http.MethodDelete, "/forwards", url.Values{"id": {fs.Arg(1)}}, nil, nil)
+	case fs.NArg() > 0 && fs.Arg(0) != "list":
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	var forwards []*runningForward
+	if err = client.Do(ctx, http.MethodGet, "/forwards", nil, nil, &forwards); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tAPP\tREMOTE\tDYNAMIC")
+	for _, forward := range forwards {
+		app := forward.App
+		if len(forward.Route) > 0 {
+			app = strings.Join(forward.Route, ",")
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", forward.ID, app, forward.RemoteAddress, forward.Dynamic)
+	}
+	return w.Flush()
+}
+
+func reloadCommand(ctx context.Context, args []string) error {
+	target := &cliTarget{}
+	fs := newFlagSet("reload", "", target)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := target.control()
+	if err != nil {
+		return err
+	}
+	return client.Do(ctx, http.MethodPost, "/reload", nil, nil, nil)
+}
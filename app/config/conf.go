@@ -2,12 +2,21 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
 	sillyKits "github.com/irealing/silly-kits"
 	"github.com/pelletier/go-toml/v2"
+	"log/slog"
 	"os"
+	"time"
 )
 
-const DefaultConfigFilename = "config.toml"
+const (
+	DefaultConfigFilename = "config.toml"
+	DefaultCertFile       = "cert.pem"
+	DefaultKeyFile        = "key.pem"
+	selfSignedValidity    = time.Hour * 24 * 825
+)
 
 func LoadConfig(filename string) (*Config, error) {
 	if filename == "" {
@@ -18,9 +27,55 @@ func LoadConfig(filename string) (*Config, error) {
 	}, func(config *Config) (*Config, error) {
 		return writeDefaultConfig(filename, config)
 	},
-		initLogger, initTLSConfig,
+		initLogger, initBackoff, initCertificate, initTLSConfig,
 	)
 }
+
+// Reload 重新读取配置文件,日志沿用当前配置
+func (c *Config) Reload(filename string) (*Config, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	return sillyKits.Apply(Default(), func(config *Config) (*Config, error) {
+		return loadConfigFile(filename, config)
+	}, initTLSConfig, func(config *Config) (*Config, error) {
+		config.logger = c.logger
+		return config, nil
+	}, initBackoff)
+}
+
+// ReadConfig 供 CLI 只读地读取配置文件:不写入默认配置与证书,日志输出到 stderr 且不替换默认 logger
+// 不读取 TLS 证书,需要建立连接时调用 LoadTLS
+func ReadConfig(filename string) (*Config, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	return sillyKits.Apply(Default(), func(config *Config) (*Config, error) {
+		return loadConfigFile(filename, config)
+	}, func(config *Config) (*Config, error) {
+		config.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: config.Log.Level}))
+		return config, nil
+	}, initBackoff)
+}
+
+// LoadTLS 读取 TLS 证书与 Remote 的 CA
+func (c *Config) LoadTLS() error {
+	_, err := initTLSConfig(c)
+	return err
+}
+
+// LoadApps 读取凭据文件中的 [[Apps]]
+func LoadApps(filename string) ([]silly_ctrl.App, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var creds struct {
+		Apps []silly_ctrl.App
+	}
+	return creds.Apps, toml.Unmarshal(buf, &creds)
+}
+
 func loadConfigFile(filename string, config *Config) (*Config, error) {
 	if _, err := os.Stat(filename); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -44,7 +99,7 @@ func writeDefaultConfig(filename string, cfg *Config) (*Config, error) {
 	}
 	defer func() {
 		if err := f.Close(); err != nil {
-			cfg.logger.Warn("write default config error", err)
+			slog.Warn("write default config error", "err", err)
 		}
 	}()
 	return cfg, toml.NewEncoder(f).Encode(cfg)
@@ -53,11 +108,61 @@ func initLogger(config *Config) (*Config, error) {
 	config.logger = config.Log.makeLogger()
 	return config, nil
 }
+
+// initBackoff InitialSeconds 或 MaxSeconds 不为正数时使用默认值,避免无延迟地反复重连
+func initBackoff(config *Config) (*Config, error) {
+	b, def := &config.Backoff, Default().Backoff
+	if b.InitialSeconds <= 0 {
+		config.Logger().Warn("invalid Backoff.InitialSeconds, use default", "initial", b.InitialSeconds, "default", def.InitialSeconds)
+		b.InitialSeconds = def.InitialSeconds
+	}
+	if b.MaxSeconds <= 0 {
+		config.Logger().Warn("invalid Backoff.MaxSeconds, use default", "max", b.MaxSeconds, "default", def.MaxSeconds)
+		b.MaxSeconds = def.MaxSeconds
+	}
+	b.MaxSeconds = max(b.MaxSeconds, b.InitialSeconds)
+	b.Jitter = min(max(b.Jitter, 0), 1)
+	return config, nil
+}
+
+// initCertificate 证书与私钥均不存在时生成自签名证书,对端需设置 SkipVerify 或固定其公钥
+func initCertificate(config *Config) (*Config, error) {
+	for _, filename := range []string{config.TLS.Cert, config.TLS.PrivateKey} {
+		if _, err := os.Stat(filename); filename == "" || !errors.Is(err, os.ErrNotExist) {
+			return config, nil
+		}
+	}
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append([]string{hostname}, hosts...)
+	}
+	cert, key, err := silly_ctrl.CreateCertificate(&silly_ctrl.CertRequest{
+		CommonName: hosts[0],
+		Hosts:      hosts,
+		Server:     true,
+		Client:     true,
+		Validity:   selfSignedValidity,
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = silly_ctrl.WriteKeyPair(config.TLS.Cert, config.TLS.PrivateKey, cert, key); err != nil {
+		return nil, err
+	}
+	config.Logger().Warn("generated self-signed certificate", "cert", config.TLS.Cert, "key", config.TLS.PrivateKey)
+	return config, nil
+}
+
 func initTLSConfig(config *Config) (*Config, error) {
-	cfg, err := config.TLS.makeTlsConfig()
+	cfg, crl, err := config.TLS.makeTlsConfig()
 	if err != nil {
 		return nil, err
 	}
-	config.tlsConfig = cfg
+	config.tlsConfig, config.crl = cfg, crl
+	for i := range config.Remote {
+		if _, err = config.Remote[i].TLSConfig(cfg, ""); err != nil {
+			return nil, fmt.Errorf("remote %s: %w", config.Remote[i].Address, err)
+		}
+	}
 	return config, nil
 }
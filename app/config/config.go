@@ -2,12 +2,16 @@ package config
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"github.com/irealing/silly-ctrl"
 	"gopkg.in/natefinch/lumberjack.v2"
 
 	"io"
 	"log/slog"
+	"net"
 	"os"
+	"time"
 )
 
 type LogConf struct {
@@ -38,46 +42,256 @@ func (cfg *LogConf) makeLogger() *slog.Logger {
 	return logger
 }
 
+// 远程连接多个地址时的连接策略
+const (
+	StrategyPriority = "priority" // 按优先级依次尝试
+	StrategyRace     = "race"     // 每隔一段时间并发尝试下一地址,先完成握手者胜出
+)
+
+// Remote 未设置 ServerName、CA 与 Pins 时使用全局 TLS 配置校验服务端证书
 type Remote struct {
-	App     silly_ctrl.App
-	Address string
+	App             silly_ctrl.App
+	Address         string   // 首选地址
+	Addresses       []string // 备用地址,优先级依次降低;以 _ 开头的名称按 DNS SRV 解析,如 _silly._udp.example.com
+	Strategy        string   // priority(默认)或 race
+	FailbackSeconds int      // 连接备用地址时每隔该秒数尝试更优先的地址,连接成功后切换;为 0 时不切回
+	ServerName      string   // 校验服务端证书的名称,默认为所连接地址的主机部分
+	CA              string   // 校验服务端证书的 CA 文件(PEM),为空时使用系统 CA
+	Pins            []string // 服务端证书公钥的 SHA-256(base64 或 hex),设置且 CA 为空时仅比对公钥,适用于自签名证书
+}
+
+// Endpoints 按优先级排列的全部地址,SRV 名称未解析
+func (remote *Remote) Endpoints() []string {
+	endpoints := make([]string, 0, len(remote.Addresses)+1)
+	if remote.Address != "" {
+		endpoints = append(endpoints, remote.Address)
+	}
+	return append(endpoints, remote.Addresses...)
+}
+
+// TLSConfig 连接 remote 的 address 使用的 TLS 配置,客户端证书沿用 base;address 为空时不设置默认的 ServerName
+func (remote *Remote) TLSConfig(base *tls.Config, address string) (*tls.Config, error) {
+	if remote.ServerName == "" && remote.CA == "" && len(remote.Pins) < 1 {
+		return base, nil
+	}
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	cfg.InsecureSkipVerify = false
+	cfg.ServerName = remote.ServerName
+	if cfg.ServerName == "" && address != "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerName = host
+	}
+	if remote.CA != "" {
+		pool, err := loadCertPool(remote.CA)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if len(remote.Pins) > 0 {
+		pins := make([][]byte, 0, len(remote.Pins))
+		for _, pin := range remote.Pins {
+			sum, err := silly_ctrl.ParsePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			pins = append(pins, sum)
+		}
+		// 证书链由 PinnedVerifier 校验
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = silly_ctrl.PinnedVerifier(pins, cfg.RootCAs, cfg.ServerName)
+	}
+	return cfg, nil
 }
+
+// Backoff 远程连接断开或失败后的重连策略
+type Backoff struct {
+	InitialSeconds  int     // 首次重连延迟(秒)
+	MaxSeconds      int     // 最大重连延迟(秒)
+	Multiplier      float64 // 每次失败后延迟的倍数
+	Jitter          float64 // 随机抖动比例,0-1
+	ResetSeconds    int     // 会话持续该秒数后断开,重连延迟从 InitialSeconds 开始
+	StopOnAuthError bool    // 对端拒绝身份(未知 App、签名错误、证书被拒)后停止重连
+}
+
+// Backoff 转换为 silly_ctrl.Backoff
+func (b *Backoff) Backoff() *silly_ctrl.Backoff {
+	return &silly_ctrl.Backoff{
+		Initial:    time.Duration(b.InitialSeconds) * time.Second,
+		Max:        time.Duration(b.MaxSeconds) * time.Second,
+		Multiplier: b.Multiplier,
+		Jitter:     b.Jitter,
+	}
+}
+
 type Forward struct {
 	Via           string
 	App           string
 	LocalAddress  string
 	RemoteAddress string
+	Select        silly_ctrl.SelectPolicy // App 存在多个会话时的选择策略
+	Network       string                  // tcp 或 udp,默认 tcp
+	IdleSeconds   int                     // udp 流空闲超时(秒),默认 60
+	Route         []string                // 多跳路由,依次经过的会话(AccessKey 或会话 ID),设置后代替 App,Via 默认为首跳
 }
+
+// ReverseForward 对端监听 RemoteAddress,连接经会话回连本端后转发至 LocalAddress
+type ReverseForward struct {
+	App           string
+	Network       string // tcp 或 udp,默认 tcp
+	RemoteAddress string
+	LocalAddress  string
+	Select        silly_ctrl.SelectPolicy
+}
+
+// Route 按目标地址选择转发的 App,未配置 Domains 与 CIDRs 时匹配所有目标
+type Route struct {
+	Domains []string // 域名后缀,example.com 匹配 example.com 及其子域名
+	CIDRs   []string // 目标为 IP 时按网段匹配
+	App     string
+	Via     string
+	Select  silly_ctrl.SelectPolicy
+}
+
+// Socks SOCKS5 代理,请求按 Routes 顺序匹配,均未命中时拒绝
+type Socks struct {
+	LocalAddress string
+	Username     string // 为空时不要求认证
+	Password     string
+	Routes       []Route // 为空时使用全局 Routes
+	IdleSeconds  int     // UDP ASSOCIATE 流空闲超时(秒),默认 60
+}
+
+// HTTPProxy HTTP 代理,支持 CONNECT 与绝对 URI 的 HTTP 请求
+type HTTPProxy struct {
+	LocalAddress string
+	Username     string // 为空时不要求 Proxy-Authorization
+	Password     string
+	Routes       []Route // 为空时使用全局 Routes
+}
+
+// 凭据来源
+const (
+	ValidatorConfig  = "config"  // 配置文件中的 Apps
+	ValidatorFile    = "file"    // 独立的凭据文件,文件变化时重新读取
+	ValidatorSQL     = "sql"     // 数据库查询,驱动需在编译时注册
+	ValidatorWebhook = "webhook" // HTTP webhook,由 webhook 校验签名
+	ValidatorCert    = "cert"    // 配置文件中的 Apps,以 TLS 客户端证书的 CN 或 SAN 确认身份
+)
+
+// Validator 握手时查询 App 的凭据来源,Type 为空时使用配置文件中的 Apps
+type Validator struct {
+	Type            string
+	Filename        string // file: 凭据文件,格式同配置文件中的 [[Apps]]
+	IntervalSeconds int    // file: 检查文件变化的间隔(秒),默认 5
+	Driver          string // sql: database/sql 驱动名,未内置任何驱动,需自行添加空白导入驱动的源文件后编译
+	DSN             string // sql: 数据源
+	Query           string // sql: 以 AccessKey 为参数,返回 Secret 与 JSON 格式的 Policy(可为 NULL)两列
+	URL             string // webhook: 地址,请求与应答格式见 silly_ctrl.WebhookRequest 与 silly_ctrl.WebhookResponse
+	TimeoutSeconds  int    // sql、webhook: 查询超时(秒),默认 5
+	CacheTTLSeconds int    // sql、webhook: 查询结果或 webhook 允许决定的缓存时间(秒),为 0 时不缓存;webhook 仅缓存提供了 TLS 客户端证书(需 TLS.ClientCA)的握手
+}
+
 type TLSConfig struct {
 	PrivateKey string
-	Cert       string
+	Cert       string // 作为客户端时同时用作客户端证书
 	SkipVerify bool
+	ClientCA   string   // 校验客户端证书的 CA 文件(PEM),设置后接入须提供由其签发的证书
+	CRL        []string // 证书吊销列表文件(PEM 或 DER),修改后重新读取并关闭证书被吊销的会话,过期的 CRL 导致握手失败
 }
 
-func (c TLSConfig) makeTlsConfig() (*tls.Config, error) {
+// makeTlsConfig 配置 CRL 时同时返回吊销列表,用于检查已建立的会话
+func (c TLSConfig) makeTlsConfig() (*tls.Config, *silly_ctrl.RevocationList, error) {
 	cert, err := tls.LoadX509KeyPair(c.Cert, c.PrivateKey)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return &tls.Config{
+	cfg := &tls.Config{
 		Certificates: []tls.Certificate{cert}, InsecureSkipVerify: c.SkipVerify,
-	}, nil
+	}
+	if c.ClientCA != "" {
+		pool, err := loadCertPool(c.ClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.ClientCAs, cfg.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	if len(c.CRL) < 1 {
+		return cfg, nil, nil
+	}
+	crl, err := silly_ctrl.NewRevocationList(c.CRL...)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.VerifyConnection = crl.VerifyConnection
+	return cfg, crl, nil
+}
+
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("no certificate found in %s", filename)
+	}
+	return pool, nil
 }
 
 type Config struct {
-	Remote    []Remote
-	Apps      []silly_ctrl.App
-	Ctrl      silly_ctrl.Config
-	Log       LogConf
-	TLS       TLSConfig
-	Forward   []Forward
-	logger    *slog.Logger
-	tlsConfig *tls.Config
+	Remote         []Remote
+	Backoff        Backoff // Remote 的重连策略
+	Apps           []silly_ctrl.App
+	Validator      Validator
+	Ctrl           silly_ctrl.Config
+	Log            LogConf
+	TLS            TLSConfig
+	Forward        []Forward
+	ReverseForward []ReverseForward
+	Socks          []Socks
+	HTTPProxy      []HTTPProxy
+	Routes         []Route // Socks 与 HTTPProxy 共用的路由表
+	Control        string  // 控制 socket 路径,可执行任意命令,为空时不启用,应置于仅当前用户可访问的目录
+	Metrics        string  // /metrics 的 HTTP 监听地址,为空时不启用
+	logger         *slog.Logger
+	tlsConfig      *tls.Config
+	crl            *silly_ctrl.RevocationList
 }
 
 func (c *Config) TLSConfig() *tls.Config {
 	return c.tlsConfig
 }
+
+// RevocationList 配置的证书吊销列表,未配置 TLS.CRL 时为 nil
+func (c *Config) RevocationList() *silly_ctrl.RevocationList {
+	return c.crl
+}
+
+// RoutesOr routes 为空时返回全局路由表
+func (c *Config) RoutesOr(routes []Route) []Route {
+	if len(routes) > 0 {
+		return routes
+	}
+	return c.Routes
+}
+
+// Listening 配置了 App 或外部凭据来源时节点需监听接入
+func (c *Config) Listening() bool {
+	return len(c.Apps) > 0 || !c.Validator.Inline()
+}
+
+// Inline 凭据来自配置文件中的 Apps
+func (v *Validator) Inline() bool {
+	return v.Type == "" || v.Type == ValidatorConfig || v.Type == ValidatorCert
+}
+
 func (c *Config) Logger() *slog.Logger {
 	return c.logger
 }
@@ -85,6 +299,14 @@ func (c *Config) Logger() *slog.Logger {
 func Default() *Config {
 	return &Config{
 		Ctrl: *silly_ctrl.DefaultConfig(),
+		TLS:  TLSConfig{Cert: DefaultCertFile, PrivateKey: DefaultKeyFile},
+		Backoff: Backoff{
+			InitialSeconds: 1,
+			MaxSeconds:     60,
+			Multiplier:     2,
+			Jitter:         0.2,
+			ResetSeconds:   30,
+		},
 		Log: LogConf{
 			Filename:  "",
 			Level:     slog.LevelWarn,
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"net/http"
+)
+
+// controlWorker 在 ControlServer 的基础上提供转发管理与配置重新加载
+// GET /forwards 列出转发,POST /forwards 以 JSON 格式的 Forward 添加转发,DELETE /forwards?id=<ID> 删除转发
+// GET /remotes 列出远程连接的状态,POST /reload 重新读取配置文件,同 SIGHUP
+type controlWorker struct {
+	cfg      *config.Config
+	node     silly_ctrl.Node
+	forwards *forwardWorker
+	remotes  *remoteWorker
+	reload   func() error
+}
+
+func (worker *controlWorker) Tag() string {
+	return "control"
+}
+
+// Run 控制 socket 启动失败不影响其他 worker
+func (worker *controlWorker) Run(ctx context.Context) error {
+	server := silly_ctrl.NewControlServer(worker.cfg.Logger(), worker.node.Manager())
+	server.HandleFunc("/forwards", worker.handleForwards)
+	server.HandleFunc("/remotes", worker.handleRemotes)
+	server.HandleFunc("/reload", worker.handleReload)
+	if err := server.Serve(ctx, worker.cfg.Control); err != nil {
+		worker.cfg.Logger().Error("control socket error", "path", worker.cfg.Control, "err", err)
+	}
+	return nil
+}
+
+func (worker *controlWorker) handleForwards(w http.ResponseWriter, r *http.Request) {
+	if !silly_ctrl.AllowMethod(w, r, http.MethodGet, http.MethodPost, http.MethodDelete) {
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var fc config.Forward
+		if err := json.NewDecoder(r.Body).Decode(&fc); err != nil {
+			silly_ctrl.WriteControlError(w, fmt.Errorf("%w: %s", silly_ctrl.BadParamError, err))
+			return
+		}
+		forward, err := worker.forwards.Add(fc, true)
+		if err != nil {
+			silly_ctrl.WriteControlError(w, err)
+			return
+		}
+		worker.cfg.Logger().Info("add forward", "forward", forward.ID)
+		silly_ctrl.WriteControlJSON(w, forward)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if err := worker.forwards.Remove(id); err != nil {
+			silly_ctrl.WriteControlError(w, err)
+			return
+		}
+		worker.cfg.Logger().Info("remove forward", "forward", id)
+		silly_ctrl.WriteControlJSON(w, struct{}{})
+	default:
+		silly_ctrl.WriteControlJSON(w, worker.forwards.List())
+	}
+}
+
+func (worker *controlWorker) handleRemotes(w http.ResponseWriter, r *http.Request) {
+	if !silly_ctrl.AllowMethod(w, r, http.MethodGet) {
+		return
+	}
+	silly_ctrl.WriteControlJSON(w, worker.remotes.List())
+}
+
+func (worker *controlWorker) handleReload(w http.ResponseWriter, r *http.Request) {
+	if !silly_ctrl.AllowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := worker.reload(); err != nil {
+		worker.cfg.Logger().Error("reload config error", "err", err)
+		silly_ctrl.WriteControlError(w, err)
+		return
+	}
+	silly_ctrl.WriteControlJSON(w, struct{}{})
+}
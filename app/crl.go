@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"time"
+)
+
+const crlWatchInterval = time.Second * 5
+
+// crlWatcher 定期检查 CRL 文件,变化时关闭证书已被吊销的会话
+type crlWatcher struct {
+	cfg  *config.Config
+	node silly_ctrl.Node
+	crl  *silly_ctrl.RevocationList
+}
+
+func (worker *crlWatcher) Tag() string {
+	return "crl-watcher"
+}
+
+func (worker *crlWatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(crlWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		changed, err := worker.crl.Refresh()
+		if err != nil {
+			worker.cfg.Logger().Error("load crl error", "err", err)
+			continue
+		}
+		if changed {
+			worker.check()
+		}
+	}
+}
+
+// check 按 tls.Config.VerifyConnection 的规则重新校验各会话的证书链
+func (worker *crlWatcher) check() {
+	logger := worker.cfg.Logger()
+	for _, sess := range worker.node.Manager().List() {
+		stater, ok := sess.(silly_ctrl.ConnectionStater)
+		if !ok {
+			continue
+		}
+		if err := worker.crl.VerifyConnection(stater.ConnectionState()); err != nil {
+			logger.Warn("close session rejected by crl", "session", sess.ID(), "app", sess.App().AccessKey, "err", err)
+			if err = sess.Close(silly_ctrl.AuthError); err != nil {
+				logger.Error("close session error", "session", sess.ID(), "err", err)
+			}
+		}
+	}
+}
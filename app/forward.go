@@ -2,31 +2,158 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/irealing/silly-ctrl"
 	"github.com/irealing/silly-ctrl/app/config"
 	"github.com/irealing/silly-ctrl/packet"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
 	"net"
+	"reflect"
+	"sort"
 	"sync"
+	"time"
 )
 
 type forwardWorker struct {
-	cfg  *config.Config
-	node silly_ctrl.Node
+	cfg      *config.Config
+	node     silly_ctrl.Node
+	mu       sync.Mutex
+	ctx      context.Context
+	wg       sync.WaitGroup
+	forwards map[string]*runningForward
 }
 
-func (worker forwardWorker) Run(ctx context.Context) error {
-	eg, ctx := errgroup.WithContext(ctx)
+// runningForward 运行中的转发,Dynamic 为经控制 socket 添加、不随配置文件重新加载的转发
+type runningForward struct {
+	ID string
+	config.Forward
+	Dynamic bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// forwardID 转发以网络类型与本地地址区分
+func forwardID(remote *config.Forward) string {
+	network := remote.Network
+	if network == "" {
+		network = "tcp"
+	}
+	return network + "/" + remote.LocalAddress
+}
+
+// Run 启动配置文件中的转发,启动失败时返回错误
+func (worker *forwardWorker) Run(ctx context.Context) error {
+	worker.mu.Lock()
+	worker.ctx = ctx
+	worker.forwards = make(map[string]*runningForward)
+	worker.mu.Unlock()
+	defer worker.wg.Wait()
 	for _, fc := range worker.cfg.Forward {
-		cfg := fc
-		eg.Go(func() error {
-			return worker.forward(ctx, &cfg)
-		})
+		if _, err := worker.Add(fc, false); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Add 监听本地地址并启动转发,监听失败时返回错误
+func (worker *forwardWorker) Add(remote config.Forward, dynamic bool) (*runningForward, error) {
+	if (remote.App == "" && len(remote.Route) < 1) || remote.LocalAddress == "" || remote.RemoteAddress == "" {
+		return nil, fmt.Errorf("%w: forward requires App or Route, LocalAddress and RemoteAddress", silly_ctrl.BadParamError)
+	}
+	id := forwardID(&remote)
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	if worker.ctx == nil || worker.ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: forward worker is not running", silly_ctrl.ApplicationOver)
+	}
+	if _, ok := worker.forwards[id]; ok {
+		return nil, fmt.Errorf("%w: forward %s already exists", silly_ctrl.BadParamError, id)
+	}
+	serve, err := worker.listen(&remote)
+	if err != nil {
+		return nil, err
 	}
-	return eg.Wait()
+	ctx, cancel := context.WithCancel(worker.ctx)
+	forward := &runningForward{ID: id, Forward: remote, Dynamic: dynamic, cancel: cancel, done: make(chan struct{})}
+	worker.forwards[id] = forward
+	worker.wg.Add(1)
+	go func() {
+		defer func() {
+			worker.mu.Lock()
+			if worker.forwards[id] == forward {
+				delete(worker.forwards, id)
+			}
+			worker.mu.Unlock()
+			close(forward.done)
+			worker.wg.Done()
+		}()
+		if err := serve(ctx); err != nil {
+			worker.cfg.Logger().Error("forward error", "forward", id, "err", err)
+		}
+	}()
+	return forward, nil
 }
-func (worker forwardWorker) listen(ctx context.Context, listener net.Listener) <-chan net.Conn {
+
+// Remove 停止转发并等待本地监听关闭
+func (worker *forwardWorker) Remove(id string) error {
+	worker.mu.Lock()
+	forward, ok := worker.forwards[id]
+	delete(worker.forwards, id)
+	worker.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: forward %s", silly_ctrl.BadParamError, id)
+	}
+	forward.cancel()
+	<-forward.done
+	return nil
+}
+
+func (worker *forwardWorker) List() []*runningForward {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	forwards := make([]*runningForward, 0, len(worker.forwards))
+	for _, forward := range worker.forwards {
+		forwards = append(forwards, forward)
+	}
+	sort.Slice(forwards, func(i, j int) bool {
+		return forwards[i].ID < forwards[j].ID
+	})
+	return forwards
+}
+
+// Sync 按重新加载的配置增删转发,配置变化的转发将重启,经控制 socket 添加的转发不受影响
+func (worker *forwardWorker) Sync(forwards []config.Forward) error {
+	want := make(map[string]config.Forward, len(forwards))
+	for _, fc := range forwards {
+		want[forwardID(&fc)] = fc
+	}
+	running := make(map[string]bool)
+	for _, forward := range worker.List() {
+		if fc, ok := want[forward.ID]; forward.Dynamic || (ok && reflect.DeepEqual(fc, forward.Forward)) {
+			running[forward.ID] = true
+			continue
+		}
+		if err := worker.Remove(forward.ID); err != nil {
+			return err
+		}
+	}
+	var errs []error
+	for id, fc := range want {
+		if running[id] {
+			continue
+		}
+		if _, err := worker.Add(fc, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (worker *forwardWorker) listenConn(ctx context.Context, listener net.Listener) <-chan net.Conn {
 	c := make(chan net.Conn)
 	go func() {
 		defer close(c)
@@ -44,13 +171,31 @@ func (worker forwardWorker) listen(ctx context.Context, listener net.Listener) <
 	}()
 	return c
 }
-func (worker forwardWorker) forward(ctx context.Context, remote *config.Forward) error {
+
+// listen 监听本地地址,返回的函数处理连接直至 ctx 结束
+func (worker *forwardWorker) listen(remote *config.Forward) (func(ctx context.Context) error, error) {
+	if silly_ctrl.IsPacketNetwork(remote.Network) {
+		conn, err := net.ListenPacket(remote.Network, remote.LocalAddress)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			return worker.forwardPacket(ctx, remote, conn)
+		}, nil
+	}
 	listener, err := net.Listen("tcp", remote.LocalAddress)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return func(ctx context.Context) error {
+		worker.forward(ctx, remote, listener)
+		return nil
+	}, nil
+}
+
+func (worker *forwardWorker) forward(ctx context.Context, remote *config.Forward, listener net.Listener) {
 	worker.cfg.Logger().Info("forward via local address", "address", remote.LocalAddress)
-	cs := worker.listen(ctx, listener)
+	cs := worker.listenConn(ctx, listener)
 	wg := sync.WaitGroup{}
 	defer wg.Wait()
 	wg.Add(1)
@@ -64,32 +209,32 @@ func (worker forwardWorker) forward(ctx context.Context, remote *config.Forward)
 		wg.Add(1)
 		go worker.forwardConn(ctx, remote, conn, &wg)
 	}
-	return nil
 }
-func (worker forwardWorker) forwardConn(ctx context.Context, remote *config.Forward, conn net.Conn, wg *sync.WaitGroup) {
+func (worker *forwardWorker) forwardConn(ctx context.Context, remote *config.Forward, conn net.Conn, wg *sync.WaitGroup) {
 	defer func() {
 		_ = conn.Close()
 		wg.Done()
 	}()
-	via := remote.Via
-	if via == "" {
-		via = remote.App
-	}
-	sess, ok := worker.node.Manager().Get(via)
+	sess, ok := silly_ctrl.Resolve(worker.node.Manager(), worker.via(remote), remote.Select)
 	if !ok {
 		worker.cfg.Logger().Error("app offline", "app", remote.App)
 		return
 	}
+	cmd := packet.ForwardRouteCommand(worker.route(remote), remote.RemoteAddress)
+	if remote.Select != "" {
+		cmd.SetParam("select", string(remote.Select))
+	}
 	err := sess.Exec(ctx,
-		packet.ForwardCommand(remote.App, remote.RemoteAddress),
+		cmd,
 		func(ctx context.Context, ret *packet.Ret, sess silly_ctrl.Session, stream quic.Stream) error {
+			app := sess.App().AccessKey
 			eg, ctx := errgroup.WithContext(ctx)
 			eg.Go(func() error {
 				defer stream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
-				return silly_ctrl.CopyWithContext(ctx, conn, stream)
+				return silly_ctrl.CopyWithContext(ctx, conn, silly_ctrl.CountingWriter(stream, app, "stream"))
 			})
 			eg.Go(func() error {
-				return silly_ctrl.CopyWithContext(ctx, stream, conn)
+				return silly_ctrl.CopyWithContext(ctx, stream, silly_ctrl.CountingWriter(conn, app, "stream"))
 			})
 			return eg.Wait()
 		},
@@ -98,6 +243,51 @@ func (worker forwardWorker) forwardConn(ctx context.Context, remote *config.Forw
 		worker.cfg.Logger().Error("forward error", "remote", remote.App, "err", err)
 	}
 }
-func (worker forwardWorker) Tag() string {
+
+// forwardPacket 按来源地址区分数据报流,每个流使用独立的 FORWARD 命令
+func (worker *forwardWorker) forwardPacket(ctx context.Context, remote *config.Forward, conn net.PacketConn) error {
+	worker.cfg.Logger().Info("forward packets via local address", "network", remote.Network, "address", remote.LocalAddress)
+	idle := time.Duration(remote.IdleSeconds) * time.Second
+	if idle <= 0 {
+		idle = time.Minute
+	}
+	return silly_ctrl.ServePacketConn(ctx, conn, func(ctx context.Context, pipe silly_ctrl.PacketPipe, addr net.Addr) {
+		sess, ok := silly_ctrl.Resolve(worker.node.Manager(), worker.via(remote), remote.Select)
+		if !ok {
+			worker.cfg.Logger().Error("app offline", "app", remote.App)
+			return
+		}
+		cmd := packet.ForwardRouteCommand(worker.route(remote), remote.RemoteAddress).
+			SetParam("network", remote.Network).
+			SetParam("idle", idle.String())
+		if remote.Select != "" {
+			cmd.SetParam("select", string(remote.Select))
+		}
+		err := silly_ctrl.PacketTunnel(ctx, sess, cmd, func(ctx context.Context, tunnel silly_ctrl.PacketPipe) error {
+			return silly_ctrl.RelayPackets(ctx, sess.App().AccessKey, pipe, tunnel, idle)
+		})
+		if err != nil {
+			worker.cfg.Logger().Error("forward packet error", "remote", remote.App, "source", addr, "err", err)
+		}
+	})
+}
+
+// route 未配置 Route 时为单跳 App
+func (worker *forwardWorker) route(remote *config.Forward) []string {
+	if len(remote.Route) > 0 {
+		return remote.Route
+	}
+	return []string{remote.App}
+}
+
+// via 发送 FORWARD 的本地会话,默认为路由首跳
+func (worker *forwardWorker) via(remote *config.Forward) string {
+	if remote.Via != "" {
+		return remote.Via
+	}
+	return worker.route(remote)[0]
+}
+
+func (worker *forwardWorker) Tag() string {
 	return "forward"
 }
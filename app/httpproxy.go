@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const httpProxyHeaderTimeout = time.Second * 30
+
+// hopHeaders 逐跳头部,转发请求与响应时移除
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// httpProxyWorker HTTP 代理,CONNECT 与绝对 URI 请求按路由转换为经会话发送的 FORWARD 命令
+type httpProxyWorker struct {
+	cfg  *config.Config
+	node silly_ctrl.Node
+}
+
+func (worker httpProxyWorker) Run(ctx context.Context) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, hc := range worker.cfg.HTTPProxy {
+		cfg := hc
+		eg.Go(func() error {
+			return worker.serve(ctx, &cfg)
+		})
+	}
+	return eg.Wait()
+}
+
+func (worker httpProxyWorker) serve(ctx context.Context, hc *config.HTTPProxy) error {
+	r, err := newRouter(worker.cfg.RoutesOr(hc.Routes))
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", hc.LocalAddress)
+	if err != nil {
+		return err
+	}
+	worker.cfg.Logger().Info("http proxy listen", "address", hc.LocalAddress)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				_ = conn.Close()
+			}()
+			if err := worker.handle(ctx, hc, r, conn); err != nil {
+				worker.cfg.Logger().Debug("http proxy connection closed", "remote", conn.RemoteAddr(), "err", err)
+			}
+		}()
+	}
+}
+
+// handle 处理客户端连接上的请求,CONNECT 之后连接转为隧道
+func (worker httpProxyWorker) handle(ctx context.Context, hc *config.HTTPProxy, r *router, conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(httpProxyHeaderTimeout)); err != nil {
+			return err
+		}
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err = conn.SetReadDeadline(time.Time{}); err != nil {
+			return err
+		}
+		if !worker.authorized(hc, req) {
+			resp := httpProxyResponse(req, http.StatusProxyAuthRequired)
+			resp.Header.Set("Proxy-Authenticate", `Basic realm="silly-ctrl"`)
+			if err = resp.Write(conn); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == http.MethodConnect {
+			return worker.connect(ctx, r, conn, reader, req)
+		}
+		keepAlive, err := worker.forward(ctx, r, conn, req)
+		if err != nil || !keepAlive {
+			return err
+		}
+	}
+}
+
+func (worker httpProxyWorker) authorized(hc *config.HTTPProxy, req *http.Request) bool {
+	if hc.Username == "" {
+		return true
+	}
+	scheme, credentials, ok := strings.Cut(req.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return false
+	}
+	username, password, _ := strings.Cut(string(decoded), ":")
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(hc.Username))
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(hc.Password))
+	return userOK&passOK == 1
+}
+
+// session 按目标地址匹配路由并选择会话,失败时返回对应的 HTTP 状态码
+func (worker httpProxyWorker) session(r *router, address string) (*packet.Command, silly_ctrl.Session, int) {
+	host, _, _ := net.SplitHostPort(address)
+	route, ok := r.match(host)
+	if !ok {
+		return nil, nil, http.StatusForbidden
+	}
+	sess, ok := r.session(worker.node.Manager(), route)
+	if !ok {
+		return nil, nil, http.StatusServiceUnavailable
+	}
+	cmd := packet.ForwardCommand(route.App, address)
+	if route.Select != "" {
+		cmd.SetParam("select", string(route.Select))
+	}
+	return cmd, sess, http.StatusOK
+}
+
+func (worker httpProxyWorker) connect(ctx context.Context, r *router, conn net.Conn, reader io.Reader, req *http.Request) error {
+	address := req.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "443")
+	}
+	cmd, sess, status := worker.session(r, address)
+	if status != http.StatusOK {
+		_ = httpProxyResponse(req, status).Write(conn)
+		return fmt.Errorf("connect %s: %s", address, http.StatusText(status))
+	}
+	replied := false
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, sess silly_ctrl.Session, stream quic.Stream) error {
+		replied = true
+		if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+			return err
+		}
+		return silly_ctrl.RelayConn(ctx, sess.App().AccessKey, conn, reader, stream)
+	})
+	if err != nil && !replied {
+		_ = httpProxyResponse(req, httpProxyStatus(err)).Write(conn)
+	}
+	return err
+}
+
+// forward 经 FORWARD stream 转发单个绝对 URI 请求,返回客户端连接是否可继续使用
+func (worker httpProxyWorker) forward(ctx context.Context, r *router, conn net.Conn, req *http.Request) (bool, error) {
+	if !req.URL.IsAbs() || req.URL.Scheme != "http" {
+		err := httpProxyResponse(req, http.StatusBadRequest).Write(conn)
+		return false, err
+	}
+	address := req.URL.Host
+	if req.URL.Port() == "" {
+		address = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	cmd, sess, status := worker.session(r, address)
+	if status != http.StatusOK {
+		if err := httpProxyResponse(req, status).Write(conn); err != nil {
+			return false, err
+		}
+		return !req.Close, nil
+	}
+	keepAlive := !req.Close
+	removeHopHeaders(req.Header)
+	req.Close = true
+	replied := false
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ silly_ctrl.Session, stream quic.Stream) error {
+		if err := req.Write(stream); err != nil {
+			return err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(stream), req)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		replied = true
+		removeHopHeaders(resp.Header)
+		// 响应未声明长度时只能通过关闭连接结束 body
+		if resp.ContentLength < 0 && len(resp.TransferEncoding) < 1 {
+			keepAlive = false
+		}
+		resp.Close = !keepAlive
+		return resp.Write(conn)
+	})
+	if err != nil {
+		if !replied {
+			_ = httpProxyResponse(req, httpProxyStatus(err)).Write(conn)
+		}
+		return false, err
+	}
+	return keepAlive, nil
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, field := range strings.Split(header.Get("Connection"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			header.Del(field)
+		}
+	}
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+}
+
+func httpProxyResponse(req *http.Request, status int) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Header:        http.Header{},
+		ContentLength: 0,
+	}
+}
+
+func httpProxyStatus(err error) int {
+	switch {
+	case errors.Is(err, silly_ctrl.PermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, silly_ctrl.UnknownSessionError):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (worker httpProxyWorker) Tag() string {
+	return "http-proxy"
+}
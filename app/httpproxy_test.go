@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"github.com/irealing/silly-ctrl/app/config"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHTTPProxyAuthorized(t *testing.T) {
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+	tests := []struct {
+		name     string
+		username string
+		header   string // Proxy-Authorization
+		want     bool
+	}{
+		{"no auth required", "", "", true},
+		{"missing", "user", "", false},
+		{"valid", "user", basic("user:pass"), true},
+		{"scheme case", "user", "basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")), true},
+		{"bad password", "user", basic("user:pasx"), false},
+		{"no password", "user", basic("user"), false},
+		{"bearer", "user", "Bearer " + base64.StdEncoding.EncodeToString([]byte("user:pass")), false},
+		{"bad base64", "user", "Basic !!!", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.header != "" {
+				req.Header.Set("Proxy-Authorization", tt.header)
+			}
+			hc := &config.HTTPProxy{Username: tt.username, Password: "pass"}
+			if got := (httpProxyWorker{}).authorized(hc, req); got != tt.want {
+				t.Fatalf("authorized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveHopHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Connection", "X-Private, keep-alive")
+	header.Set("X-Private", "1")
+	header.Set("Keep-Alive", "timeout=5")
+	header.Set("Proxy-Authorization", "Basic dXNlcjpwYXNz")
+	header.Set("Transfer-Encoding", "chunked")
+	header.Set("Accept", "*/*")
+	removeHopHeaders(header)
+	if len(header) != 1 || header.Get("Accept") != "*/*" {
+		t.Fatalf("headers after removeHopHeaders: %v", header)
+	}
+}
+
+func TestHTTPProxyHandle(t *testing.T) {
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		hc := &config.HTTPProxy{Username: "user", Password: "pass"}
+		done <- httpProxyWorker{}.handle(context.Background(), hc, nil, server)
+		_ = server.Close()
+	}()
+	reader := bufio.NewReader(client)
+	// 未认证的请求返回 407,连接保持
+	// 认证后非绝对 URI 的请求返回 400 并关闭连接
+	requests := []struct {
+		request string
+		status  int
+	}{
+		{"GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n", http.StatusProxyAuthRequired},
+		{"GET / HTTP/1.1\r\nHost: example.com\r\nProxy-Authorization: Basic dXNlcjpwYXNz\r\n\r\n", http.StatusBadRequest},
+	}
+	for _, r := range requests {
+		go func(request string) {
+			_, _ = client.Write([]byte(request))
+		}(r.request)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != r.status {
+			t.Fatalf("%q: status %d, want %d", strings.SplitN(r.request, "\r\n", 2)[0], resp.StatusCode, r.status)
+		}
+		if r.status == http.StatusProxyAuthRequired && resp.Header.Get("Proxy-Authenticate") == "" {
+			t.Fatal("407 without Proxy-Authenticate")
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("handle() = %v", err)
+	}
+	_ = client.Close()
+}
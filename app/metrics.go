@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"net"
+	"net/http"
+	"time"
+)
+
+// metricsWorker 以 Prometheus 文本格式在 /metrics 导出运行指标
+type metricsWorker struct {
+	cfg  *config.Config
+	node silly_ctrl.Node
+}
+
+func (worker *metricsWorker) Tag() string {
+	return "metrics"
+}
+
+// Run 指标端口监听失败不影响其他 worker
+func (worker *metricsWorker) Run(ctx context.Context) error {
+	silly_ctrl.DefaultMetrics.CollectSessions(worker.node.Manager())
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", silly_ctrl.DefaultMetrics)
+	server := &http.Server{
+		Addr:              worker.cfg.Metrics,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	stop := context.AfterFunc(ctx, func() { _ = server.Close() })
+	defer stop()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		worker.cfg.Logger().Error("metrics server error", "addr", worker.cfg.Metrics, "err", err)
+	}
+	return nil
+}
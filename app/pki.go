@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultPKIDir = "pki"
+	day           = time.Hour * 24
+	crlValidity   = day * 30
+)
+
+// pkiIndex CA 目录中的签发记录
+type pkiIndex struct {
+	CRLNumber int64        `json:"crl_number"`
+	Certs     []*pkiRecord `json:"certs"`
+}
+
+type pkiRecord struct {
+	Serial     string    `json:"serial"`
+	CommonName string    `json:"common_name"`
+	Usage      string    `json:"usage"`
+	NotAfter   time.Time `json:"not_after"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty"`
+}
+
+// pkiDir 本地 CA 目录,包含 ca.pem、ca.key、crl.pem 与 index.json
+type pkiDir string
+
+func (dir pkiDir) path(name string) string {
+	return filepath.Join(string(dir), name)
+}
+
+func (dir pkiDir) loadIndex() (*pkiIndex, error) {
+	buf, err := os.ReadFile(dir.path("index.json"))
+	if err != nil {
+		return nil, err
+	}
+	index := &pkiIndex{}
+	return index, json.Unmarshal(buf, index)
+}
+
+func (dir pkiDir) saveIndex(index *pkiIndex) error {
+	buf, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dir.path("index.json"), buf, 0600)
+}
+
+func (dir pkiDir) loadCA() (*x509.Certificate, crypto.Signer, error) {
+	return silly_ctrl.LoadKeyPair(dir.path("ca.pem"), dir.path("ca.key"))
+}
+
+// writeCRL 按签发记录重新签发吊销列表
+func (dir pkiDir) writeCRL(index *pkiIndex) error {
+	ca, key, err := dir.loadCA()
+	if err != nil {
+		return err
+	}
+	var revoked []x509.RevocationListEntry
+	for _, record := range index.Certs {
+		if record.RevokedAt.IsZero() {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(record.Serial, 16)
+		if !ok {
+			return fmt.Errorf("bad serial %s in index", record.Serial)
+		}
+		revoked = append(revoked, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: record.RevokedAt})
+	}
+	index.CRLNumber++
+	crl, err := silly_ctrl.CreateCRL(ca, key, index.CRLNumber, revoked, crlValidity)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(dir.path("crl.pem"), crl, 0644); err != nil {
+		return err
+	}
+	return dir.saveIndex(index)
+}
+
+// pkiCommands pki 的子命令
+var pkiCommands = map[string]cliCommand{
+	"init":   pkiInitCommand,
+	"issue":  pkiIssueCommand,
+	"revoke": pkiRevokeCommand,
+	"crl":    pkiCRLCommand,
+	"list":   pkiListCommand,
+	"pin":    pkiPinCommand,
+}
+
+func pkiCommand(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		if command, ok := pkiCommands[args[0]]; ok {
+			return command(ctx, args[1:])
+		}
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "usage: silly-ctrl pki init|issue|revoke|crl|list|pin [flags]")
+	return flag.ErrHelp
+}
+
+func newPKIFlagSet(name, usage string, dir *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("pki "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "usage: silly-ctrl pki %s [flags] %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	if dir != nil {
+		fs.StringVar(dir, "dir", defaultPKIDir, "CA directory")
+	}
+	return fs
+}
+
+func pkiInitCommand(_ context.Context, args []string) error {
+	var dir string
+	fs := newPKIFlagSet("init", "", &dir)
+	cn := fs.String("cn", "silly-ctrl CA", "common name of the CA")
+	days := fs.Int("days", 3650, "validity in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pki := pkiDir(dir)
+	if _, err := os.Stat(pki.path("ca.pem")); err == nil {
+		return fmt.Errorf("CA already exists in %s", dir)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	ca, key, err := silly_ctrl.CreateCertificate(&silly_ctrl.CertRequest{
+		CommonName: *cn,
+		CA:         true,
+		Validity:   time.Duration(*days) * day,
+	}, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err = silly_ctrl.WriteKeyPair(pki.path("ca.pem"), pki.path("ca.key"), ca, key); err != nil {
+		return err
+	}
+	if err = pki.writeCRL(&pkiIndex{}); err != nil {
+		return err
+	}
+	fmt.Println(pki.path("ca.pem"))
+	return nil
+}
+
+// pkiIssueCommand 签发证书,server 证书未指定 SAN 时以 CN 作为 SAN,client 证书的 CN 对应 App 的 AccessKey
+// 输出文件已存在时须指定 -force,被替换的证书将被吊销
+func pkiIssueCommand(_ context.Context, args []string) error {
+	var dir string
+	fs := newPKIFlagSet("issue", "<common name> [SAN...]", &dir)
+	usage := fs.String("usage", "client", "server, client (agent identity for mTLS) or both")
+	days := fs.Int("days", 825, "validity in days")
+	out := fs.String("out", "", "output file prefix (default <dir>/<common name>)")
+	force := fs.Bool("force", false, "replace existing output files and revoke the certificate they held")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	req := &silly_ctrl.CertRequest{
+		CommonName: fs.Arg(0),
+		Hosts:      fs.Args()[1:],
+		Validity:   time.Duration(*days) * day,
+	}
+	switch *usage {
+	case "server":
+		req.Server = true
+	case "client":
+		req.Client = true
+	case "both":
+		req.Server, req.Client = true, true
+	default:
+		return fmt.Errorf("unknown usage %s", *usage)
+	}
+	if req.Server && len(req.Hosts) < 1 {
+		req.Hosts = []string{req.CommonName}
+	}
+	pki := pkiDir(dir)
+	index, err := pki.loadIndex()
+	if err != nil {
+		return err
+	}
+	prefix := *out
+	if prefix == "" {
+		prefix = pki.path(strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(req.CommonName))
+	}
+	superseded, err := supersededSerial(prefix, *force)
+	if err != nil {
+		return err
+	}
+	ca, caKey, err := pki.loadCA()
+	if err != nil {
+		return err
+	}
+	cert, key, err := silly_ctrl.CreateCertificate(req, ca, caKey)
+	if err != nil {
+		return err
+	}
+	if err = silly_ctrl.WriteKeyPair(prefix+".pem", prefix+".key", cert, key); err != nil {
+		return err
+	}
+	index.Certs = append(index.Certs, &pkiRecord{
+		Serial:     cert.SerialNumber.Text(16),
+		CommonName: req.CommonName,
+		Usage:      *usage,
+		NotAfter:   cert.NotAfter,
+	})
+	fmt.Println(prefix+".pem", prefix+".key")
+	revoked := false
+	for _, record := range index.Certs {
+		if superseded != "" && record.RevokedAt.IsZero() && strings.EqualFold(record.Serial, superseded) {
+			record.RevokedAt = time.Now()
+			revoked = true
+			fmt.Println("revoked", record.Serial, record.CommonName)
+		}
+	}
+	if revoked {
+		return pki.writeCRL(index)
+	}
+	return pki.saveIndex(index)
+}
+
+// supersededSerial 检查 prefix 对应的输出文件,已存在且未指定 force 时返回错误,否则返回将被替换的证书序列号
+func supersededSerial(prefix string, force bool) (string, error) {
+	exists := false
+	for _, filename := range []string{prefix + ".pem", prefix + ".key"} {
+		if _, err := os.Lstat(filename); err == nil {
+			exists = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	if !exists {
+		return "", nil
+	}
+	if !force {
+		return "", fmt.Errorf("%s.pem or %s.key already exists, use -force to replace it and revoke the old certificate", prefix, prefix)
+	}
+	cert, err := readCertificate(prefix + ".pem")
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return cert.SerialNumber.Text(16), nil
+}
+
+func readCertificate(filename string) (*x509.Certificate, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s: no certificate", filename)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// pkiRevokeCommand 按序列号或 CN 吊销证书并重新签发吊销列表
+func pkiRevokeCommand(_ context.Context, args []string) error {
+	var dir string
+	fs := newPKIFlagSet("revoke", "<serial | common name>", &dir)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	pki := pkiDir(dir)
+	index, err := pki.loadIndex()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	revoked := 0
+	for _, record := range index.Certs {
+		if record.RevokedAt.IsZero() && (strings.EqualFold(record.Serial, fs.Arg(0)) || record.CommonName == fs.Arg(0)) {
+			record.RevokedAt = now
+			revoked++
+			fmt.Println(record.Serial, record.CommonName)
+		}
+	}
+	if revoked < 1 {
+		return fmt.Errorf("no unrevoked certificate matches %s", fs.Arg(0))
+	}
+	return pki.writeCRL(index)
+}
+
+// pkiCRLCommand 重新签发吊销列表,需在有效期(30 天)内定期执行
+func pkiCRLCommand(_ context.Context, args []string) error {
+	var dir string
+	fs := newPKIFlagSet("crl", "", &dir)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pki := pkiDir(dir)
+	index, err := pki.loadIndex()
+	if err != nil {
+		return err
+	}
+	return pki.writeCRL(index)
+}
+
+func pkiListCommand(_ context.Context, args []string) error {
+	var dir string
+	fs := newPKIFlagSet("list", "", &dir)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	index, err := pkiDir(dir).loadIndex()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SERIAL\tCOMMON NAME\tUSAGE\tNOT AFTER\tREVOKED")
+	for _, record := range index.Certs {
+		revoked := "-"
+		if !record.RevokedAt.IsZero() {
+			revoked = record.RevokedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", record.Serial, record.CommonName, record.Usage, record.NotAfter.Format(time.DateOnly), revoked)
+	}
+	return w.Flush()
+}
+
+// pkiPinCommand 输出证书公钥的 SPKI SHA-256,用于 Remote.Pins
+func pkiPinCommand(_ context.Context, args []string) error {
+	fs := newPKIFlagSet("pin", "<cert.pem>...", nil)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	for _, filename := range fs.Args() {
+		cert, err := readCertificate(filename)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s  %s\n", silly_ctrl.SPKIPin(cert), filename)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// reloader 重新读取配置文件并与运行状态比对,仅调整变化的 App、转发与远程连接,不影响其余会话
+type reloader struct {
+	mu       sync.Mutex
+	filename string
+	current  *config.Config
+	node     silly_ctrl.Node
+	apps     silly_ctrl.AppUpdater // 凭据来自配置文件中的 Apps 时有效
+	forwards *forwardWorker
+	remotes  *remoteWorker
+}
+
+func (r *reloader) Tag() string {
+	return "reload"
+}
+
+// Run 收到 SIGHUP 时重新加载配置
+func (r *reloader) Run(ctx context.Context) error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ch:
+			if err := r.Reload(); err != nil {
+				r.current.Logger().Error("reload config error", "filename", r.filename, "err", err)
+			}
+		}
+	}
+}
+
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg, err := r.current.Reload(r.filename)
+	if err != nil {
+		return err
+	}
+	logger := r.current.Logger()
+	if fields := restartFields(r.current, cfg); len(fields) > 0 {
+		logger.Warn("config changes require restart", "fields", fields)
+	}
+	if cfg.Validator.Inline() && r.apps != nil {
+		r.apps.UpdateApps(cfg.Apps)
+		closeAppSessions(logger, r.node.Manager(), cfg.Apps)
+	}
+	r.remotes.Sync(cfg.Remote)
+	err = r.forwards.Sync(cfg.Forward)
+	r.current = cfg
+	logger.Info("config reloaded", "filename", r.filename, "apps", len(cfg.Apps), "remotes", len(cfg.Remote), "forwards", len(cfg.Forward))
+	return err
+}
+
+// closeAppSessions 关闭 App 已删除或密钥、策略已变更的接入会话
+func closeAppSessions(logger *slog.Logger, manager silly_ctrl.SessionManager, apps []silly_ctrl.App) {
+	want := make(map[string]silly_ctrl.App, len(apps))
+	for _, app := range apps {
+		want[app.AccessKey] = app
+	}
+	for _, sess := range manager.List() {
+		if sess.IsRemote() {
+			continue
+		}
+		app, ok := want[sess.App().AccessKey]
+		if ok && reflect.DeepEqual(&app, sess.App()) {
+			continue
+		}
+		reason := silly_ctrl.UnknownAppError
+		if ok {
+			reason = silly_ctrl.AuthError
+		}
+		logger.Info("close session of reloaded app", "session", sess.ID(), "app", sess.App().AccessKey, "reason", reason)
+		_ = sess.Close(reason)
+	}
+}
+
+// restartFields 返回变更后需重启节点才能生效的配置项
+func restartFields(old, cfg *config.Config) []string {
+	var fields []string
+	for name, changed := range map[string]bool{
+		"Ctrl":           !reflect.DeepEqual(old.Ctrl, cfg.Ctrl),
+		"TLS":            !reflect.DeepEqual(old.TLS, cfg.TLS),
+		"Log":            !reflect.DeepEqual(old.Log, cfg.Log),
+		"Validator":      !reflect.DeepEqual(old.Validator, cfg.Validator),
+		"Backoff":        old.Backoff != cfg.Backoff,
+		"Control":        old.Control != cfg.Control,
+		"Metrics":        old.Metrics != cfg.Metrics,
+		"ReverseForward": !reflect.DeepEqual(old.ReverseForward, cfg.ReverseForward),
+		"Socks":          !reflect.DeepEqual(old.Socks, cfg.Socks),
+		"HTTPProxy":      !reflect.DeepEqual(old.HTTPProxy, cfg.HTTPProxy),
+		"Routes":         !reflect.DeepEqual(old.Routes, cfg.Routes),
+		"Apps":           !old.Listening() && cfg.Listening(), // 未配置 App 时节点不监听
+	} {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
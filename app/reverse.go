@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"time"
+)
+
+const reverseRetryInterval = time.Second * 5
+
+type reverseWorker struct {
+	cfg  *config.Config
+	node silly_ctrl.Node
+}
+
+func (worker reverseWorker) Run(ctx context.Context) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, rc := range worker.cfg.ReverseForward {
+		cfg := rc
+		eg.Go(func() error {
+			return worker.reverse(ctx, &cfg)
+		})
+	}
+	return eg.Wait()
+}
+
+// reverse 请求对端监听,会话断开后等待重试
+func (worker reverseWorker) reverse(ctx context.Context, remote *config.ReverseForward) error {
+	network := remote.Network
+	if network == "" {
+		network = "tcp"
+	}
+	for {
+		if sess, ok := worker.node.Manager().Select(remote.App, remote.Select); ok {
+			worker.cfg.Logger().Info("reverse forward", "app", remote.App, "remote", remote.RemoteAddress, "local", remote.LocalAddress)
+			err := sess.Exec(ctx,
+				packet.ListenCommand(network, remote.RemoteAddress, remote.LocalAddress),
+				func(ctx context.Context, ret *packet.Ret, sess silly_ctrl.Session, stream quic.Stream) error {
+					ctx, cancel := context.WithCancel(ctx)
+					defer cancel()
+					go func() {
+						<-ctx.Done()
+						stream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
+					}()
+					_, err := io.Copy(io.Discard, stream)
+					return err
+				},
+			)
+			if err != nil {
+				worker.cfg.Logger().Error("reverse forward error", "app", remote.App, "remote", remote.RemoteAddress, "err", err)
+			}
+		} else {
+			worker.cfg.Logger().Debug("app offline", "app", remote.App)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reverseRetryInterval):
+		}
+	}
+}
+func (worker reverseWorker) Tag() string {
+	return "reverse"
+}
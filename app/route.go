@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"net"
+	"strings"
+)
+
+type compiledRoute struct {
+	route    config.Route
+	domains  []string
+	networks []*net.IPNet
+}
+
+// match 未配置匹配条件的路由匹配所有目标
+func (r *compiledRoute) match(host string) bool {
+	if len(r.domains) < 1 && len(r.networks) < 1 {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, network := range r.networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range r.domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// router 按目标主机选择转发的 App,规则按配置顺序匹配
+type router struct {
+	routes []*compiledRoute
+}
+
+func newRouter(routes []config.Route) (*router, error) {
+	r := &router{}
+	for _, route := range routes {
+		if route.App == "" {
+			return nil, fmt.Errorf("route without app")
+		}
+		cr := &compiledRoute{route: route}
+		for _, domain := range route.Domains {
+			cr.domains = append(cr.domains, strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(domain), "."), "."))
+		}
+		for _, cidr := range route.CIDRs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("route %s bad cidr %s: %w", route.App, cidr, err)
+			}
+			cr.networks = append(cr.networks, network)
+		}
+		r.routes = append(r.routes, cr)
+	}
+	return r, nil
+}
+
+func (r *router) match(host string) (*config.Route, bool) {
+	for _, route := range r.routes {
+		if route.match(host) {
+			return &route.route, true
+		}
+	}
+	return nil, false
+}
+
+// session 选择路由对应的会话,Via 为空时直接使用 App,无直连会话时经路由表选择下一跳
+func (r *router) session(manager silly_ctrl.SessionManager, route *config.Route) (silly_ctrl.Session, bool) {
+	via := route.Via
+	if via == "" {
+		via = route.App
+	}
+	return silly_ctrl.Resolve(manager, via, route.Select)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/sync/errgroup"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	socksVersion          = 5
+	socksHandshakeTimeout = time.Second * 10
+
+	socksAuthNone         = 0
+	socksAuthPassword     = 2
+	socksAuthNoAcceptable = 0xff
+
+	socksCmdConnect      = 1
+	socksCmdUDPAssociate = 3
+
+	socksAtypIPv4   = 1
+	socksAtypDomain = 3
+	socksAtypIPv6   = 4
+
+	socksRepSucceeded          = 0
+	socksRepFailure            = 1
+	socksRepNotAllowed         = 2
+	socksRepHostUnreachable    = 4
+	socksRepCmdNotSupported    = 7
+	socksRepAtypNotSupported   = 8
+	socksPasswordVersion       = 1
+	socksPasswordStatusFailure = 1
+)
+
+var errSocksAtyp = errors.New("socks address type not supported")
+
+// socksWorker SOCKS5 代理,CONNECT 与 UDP ASSOCIATE 请求按路由转换为经会话发送的 FORWARD 命令
+type socksWorker struct {
+	cfg  *config.Config
+	node silly_ctrl.Node
+}
+
+func (worker socksWorker) Run(ctx context.Context) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, sc := range worker.cfg.Socks {
+		cfg := sc
+		eg.Go(func() error {
+			return worker.serve(ctx, &cfg)
+		})
+	}
+	return eg.Wait()
+}
+
+func (worker socksWorker) serve(ctx context.Context, sc *config.Socks) error {
+	r, err := newRouter(worker.cfg.RoutesOr(sc.Routes))
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", sc.LocalAddress)
+	if err != nil {
+		return err
+	}
+	worker.cfg.Logger().Info("socks5 proxy listen", "address", sc.LocalAddress)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				_ = conn.Close()
+			}()
+			if err := worker.handle(ctx, sc, r, conn); err != nil {
+				worker.cfg.Logger().Debug("socks5 connection closed", "remote", conn.RemoteAddr(), "err", err)
+			}
+		}()
+	}
+}
+
+func (worker socksWorker) handle(ctx context.Context, sc *config.Socks, r *router, conn net.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(socksHandshakeTimeout)); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	if err := worker.auth(sc, reader, conn); err != nil {
+		return err
+	}
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return err
+	}
+	if header[0] != socksVersion {
+		return fmt.Errorf("bad socks version %d", header[0])
+	}
+	address, err := readSocksAddr(reader)
+	if err != nil {
+		if errors.Is(err, errSocksAtyp) {
+			_ = writeSocksReply(conn, socksRepAtypNotSupported, nil)
+		}
+		return err
+	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+	switch header[1] {
+	case socksCmdConnect:
+		return worker.connect(ctx, r, conn, reader, address)
+	case socksCmdUDPAssociate:
+		return worker.associate(ctx, sc, r, conn, reader)
+	default:
+		_ = writeSocksReply(conn, socksRepCmdNotSupported, nil)
+		return fmt.Errorf("socks command %d not supported", header[1])
+	}
+}
+
+// auth 协商认证方式,配置 Username 时要求 RFC 1929 用户名密码认证
+func (worker socksWorker) auth(sc *config.Socks, reader *bufio.Reader, conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return err
+	}
+	if header[0] != socksVersion {
+		return fmt.Errorf("bad socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return err
+	}
+	method := byte(socksAuthNone)
+	if sc.Username != "" {
+		method = socksAuthPassword
+	}
+	if bytes.IndexByte(methods, method) < 0 {
+		_, _ = conn.Write([]byte{socksVersion, socksAuthNoAcceptable})
+		return fmt.Errorf("no acceptable socks auth method")
+	}
+	if _, err := conn.Write([]byte{socksVersion, method}); err != nil {
+		return err
+	}
+	if method == socksAuthNone {
+		return nil
+	}
+	ver, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if ver != socksPasswordVersion {
+		return fmt.Errorf("bad socks auth version %d", ver)
+	}
+	username, err := readSocksString(reader)
+	if err != nil {
+		return err
+	}
+	password, err := readSocksString(reader)
+	if err != nil {
+		return err
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(sc.Username))
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(sc.Password))
+	if userOK&passOK != 1 {
+		_, _ = conn.Write([]byte{socksPasswordVersion, socksPasswordStatusFailure})
+		return fmt.Errorf("%w: socks user %s", silly_ctrl.AuthError, username)
+	}
+	_, err = conn.Write([]byte{socksPasswordVersion, 0})
+	return err
+}
+
+func (worker socksWorker) connect(ctx context.Context, r *router, conn net.Conn, reader io.Reader, address string) error {
+	host, _, _ := net.SplitHostPort(address)
+	route, ok := r.match(host)
+	if !ok {
+		_ = writeSocksReply(conn, socksRepNotAllowed, nil)
+		return fmt.Errorf("no route for %s", address)
+	}
+	sess, ok := r.session(worker.node.Manager(), route)
+	if !ok {
+		_ = writeSocksReply(conn, socksRepHostUnreachable, nil)
+		return fmt.Errorf("%w: app %s offline", silly_ctrl.UnknownSessionError, route.App)
+	}
+	cmd := packet.ForwardCommand(route.App, address)
+	if route.Select != "" {
+		cmd.SetParam("select", string(route.Select))
+	}
+	replied := false
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ silly_ctrl.Session, stream quic.Stream) error {
+		replied = true
+		if err := writeSocksReply(conn, socksRepSucceeded, nil); err != nil {
+			return err
+		}
+		return silly_ctrl.RelayConn(ctx, sess.App().AccessKey, conn, reader, stream)
+	})
+	if err != nil && !replied {
+		_ = writeSocksReply(conn, socksReplyCode(err), nil)
+	}
+	return err
+}
+
+// associate 为 UDP ASSOCIATE 分配本地 UDP 端口,按目标地址建立数据报流,控制连接关闭时结束
+func (worker socksWorker) associate(ctx context.Context, sc *config.Socks, r *router, conn net.Conn, reader io.Reader) error {
+	host, _, err := net.SplitHostPort(conn.LocalAddr().String())
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		_ = writeSocksReply(conn, socksRepFailure, nil)
+		return err
+	}
+	if err = writeSocksReply(conn, socksRepSucceeded, pc.LocalAddr()); err != nil {
+		_ = pc.Close()
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		defer cancel()
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = pc.Close()
+	}()
+	idle := time.Duration(sc.IdleSeconds) * time.Second
+	if idle <= 0 {
+		idle = time.Minute
+	}
+	clientIP := conn.RemoteAddr().(*net.TCPAddr).IP
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	var mu sync.Mutex
+	dests := make(map[string]*socksDest)
+	buf := make([]byte, silly_ctrl.MaxPacketSize)
+	for {
+		n, src, err := pc.ReadFrom(buf)
+		if err != nil {
+			return nil
+		}
+		if addr, ok := src.(*net.UDPAddr); !ok || !addr.IP.Equal(clientIP) {
+			continue
+		}
+		// RSV(2) FRAG(1) ATYP DST.ADDR DST.PORT DATA,不支持分片
+		if n < 4 || buf[2] != 0 {
+			continue
+		}
+		data := bytes.NewReader(buf[3:n])
+		address, err := readSocksAddr(data)
+		if err != nil {
+			continue
+		}
+		headerLen := n - data.Len()
+		mu.Lock()
+		dest, ok := dests[address]
+		if !ok {
+			dest = &socksDest{
+				conn:   pc,
+				client: src,
+				header: append([]byte(nil), buf[:headerLen]...),
+				in:     make(chan []byte, 64),
+				closed: make(chan struct{}),
+			}
+			dests[address] = dest
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					mu.Lock()
+					delete(dests, address)
+					mu.Unlock()
+					_ = dest.Close()
+				}()
+				if err := worker.relayPacket(ctx, r, dest, address, idle); err != nil {
+					worker.cfg.Logger().Debug("socks5 udp flow closed", "client", src, "target", address, "err", err)
+				}
+			}()
+		}
+		mu.Unlock()
+		select {
+		case dest.in <- append([]byte(nil), buf[headerLen:n]...):
+		default:
+		}
+	}
+}
+
+func (worker socksWorker) relayPacket(ctx context.Context, r *router, dest *socksDest, address string, idle time.Duration) error {
+	host, _, _ := net.SplitHostPort(address)
+	route, ok := r.match(host)
+	if !ok {
+		return fmt.Errorf("no route for %s", address)
+	}
+	sess, ok := r.session(worker.node.Manager(), route)
+	if !ok {
+		return fmt.Errorf("%w: app %s offline", silly_ctrl.UnknownSessionError, route.App)
+	}
+	cmd := packet.ForwardCommand(route.App, address).
+		SetParam("network", "udp").
+		SetParam("idle", idle.String())
+	if route.Select != "" {
+		cmd.SetParam("select", string(route.Select))
+	}
+	return silly_ctrl.PacketTunnel(ctx, sess, cmd, func(ctx context.Context, tunnel silly_ctrl.PacketPipe) error {
+		return silly_ctrl.RelayPackets(ctx, sess.App().AccessKey, dest, tunnel, idle)
+	})
+}
+
+// socksDest UDP ASSOCIATE 中单个目标地址的数据报流,回复时附加该目标的 SOCKS5 UDP 头
+type socksDest struct {
+	conn   net.PacketConn
+	client net.Addr
+	header []byte
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (dest *socksDest) ReadPacket(buf []byte) (int, error) {
+	select {
+	case data := <-dest.in:
+		return copy(buf, data), nil
+	case <-dest.closed:
+		return 0, io.EOF
+	}
+}
+
+func (dest *socksDest) WritePacket(p []byte) error {
+	_, err := dest.conn.WriteTo(append(append([]byte(nil), dest.header...), p...), dest.client)
+	return err
+}
+
+func (dest *socksDest) Close() error {
+	dest.once.Do(func() {
+		close(dest.closed)
+	})
+	return nil
+}
+
+func readSocksString(reader io.ByteReader) (string, error) {
+	l, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, l)
+	for i := range buf {
+		if buf[i], err = reader.ReadByte(); err != nil {
+			return "", err
+		}
+	}
+	return string(buf), nil
+}
+
+// readSocksAddr 读取 ATYP DST.ADDR DST.PORT,返回 host:port
+func readSocksAddr(reader interface {
+	io.Reader
+	io.ByteReader
+}) (string, error) {
+	atyp, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var host string
+	switch atyp {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if atyp == socksAtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err = io.ReadFull(reader, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksAtypDomain:
+		if host, err = readSocksString(reader); err != nil {
+			return "", err
+		}
+	default:
+		return "", errSocksAtyp
+	}
+	port := make([]byte, 2)
+	if _, err = io.ReadFull(reader, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSocksReply addr 为空时使用 0.0.0.0:0
+func writeSocksReply(w io.Writer, rep byte, addr net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	}
+	buf := []byte{socksVersion, rep, 0}
+	if ip4 := ip.To4(); ip4 != nil {
+		buf = append(append(buf, socksAtypIPv4), ip4...)
+	} else {
+		buf = append(append(buf, socksAtypIPv6), ip.To16()...)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(port))
+	_, err := w.Write(buf)
+	return err
+}
+
+func socksReplyCode(err error) byte {
+	switch {
+	case errors.Is(err, silly_ctrl.PermissionDenied):
+		return socksRepNotAllowed
+	case errors.Is(err, silly_ctrl.UnknownSessionError):
+		return socksRepHostUnreachable
+	default:
+		return socksRepFailure
+	}
+}
+
+func (worker socksWorker) Tag() string {
+	return "socks"
+}
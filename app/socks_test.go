@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestReadSocksAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		err  error
+	}{
+		{"ipv4", []byte{socksAtypIPv4, 10, 0, 0, 1, 0, 80}, "10.0.0.1:80", nil},
+		{"ipv6", append(append([]byte{socksAtypIPv6}, net.ParseIP("::1")...), 0x1f, 0x90), "[::1]:8080", nil},
+		{"domain", append([]byte{socksAtypDomain, 11}, "example.com\x01\xbb"...), "example.com:443", nil},
+		{"bad atyp", []byte{2, 0, 0}, "", errSocksAtyp},
+		{"truncated ipv4", []byte{socksAtypIPv4, 10, 0}, "", io.ErrUnexpectedEOF},
+		{"truncated domain", []byte{socksAtypDomain, 11, 'e'}, "", io.EOF},
+		{"missing port", []byte{socksAtypIPv4, 10, 0, 0, 1, 0}, "", io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSocksAddr(bytes.NewReader(tt.data))
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Fatalf("readSocksAddr() = %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestWriteSocksReply(t *testing.T) {
+	tests := []struct {
+		name string
+		rep  byte
+		addr net.Addr
+		want []byte
+	}{
+		{"empty", socksRepFailure, nil, []byte{5, socksRepFailure, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0}},
+		{"udp ipv4", socksRepSucceeded, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1080}, []byte{5, 0, 0, socksAtypIPv4, 127, 0, 0, 1, 4, 0x38}},
+		{"tcp ipv6", socksRepSucceeded, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 1}, append(append([]byte{5, 0, 0, socksAtypIPv6}, net.ParseIP("::1")...), 0, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := writeSocksReply(buf, tt.rep, tt.addr); err != nil || !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Fatalf("writeSocksReply() = %v, %v, want %v", buf.Bytes(), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSocksAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		request  []byte // 客户端发送的方法协商与认证请求
+		reply    []byte // 代理返回的全部数据
+		ok       bool
+		err      error // 不为空时检查错误类型
+	}{
+		{"no auth", "", []byte{5, 1, socksAuthNone}, []byte{5, socksAuthNone}, true, nil},
+		{"no acceptable", "", []byte{5, 1, socksAuthPassword}, []byte{5, socksAuthNoAcceptable}, false, nil},
+		{"password", "user", []byte{5, 2, socksAuthNone, socksAuthPassword, 1, 4, 'u', 's', 'e', 'r', 4, 'p', 'a', 's', 's'}, []byte{5, socksAuthPassword, 1, 0}, true, nil},
+		{"password required", "user", []byte{5, 1, socksAuthNone}, []byte{5, socksAuthNoAcceptable}, false, nil},
+		{"bad password", "user", []byte{5, 1, socksAuthPassword, 1, 4, 'u', 's', 'e', 'r', 4, 'p', 'a', 's', 'x'}, []byte{5, socksAuthPassword, 1, socksPasswordStatusFailure}, false, silly_ctrl.AuthError},
+		{"bad version", "", []byte{4, 1, socksAuthNone}, nil, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := socksExchange(t, func(conn net.Conn) error {
+				return socksWorker{}.auth(&config.Socks{Username: tt.username, Password: "pass"}, bufio.NewReader(conn), conn)
+			}, tt.request)
+			if !bytes.Equal(reply, tt.reply) {
+				t.Fatalf("reply = %v, want %v", reply, tt.reply)
+			}
+			if (err == nil) != tt.ok {
+				t.Fatalf("auth() = %v, want ok %v", err, tt.ok)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("auth() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSocksHandleRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		rep     byte
+	}{
+		{"bad atyp", []byte{5, socksCmdConnect, 0, 2}, socksRepAtypNotSupported},
+		{"bind", []byte{5, 2, 0, socksAtypIPv4, 10, 0, 0, 1, 0, 80}, socksRepCmdNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := append([]byte{5, 1, socksAuthNone}, tt.request...)
+			reply, err := socksExchange(t, func(conn net.Conn) error {
+				return socksWorker{}.handle(context.Background(), &config.Socks{}, nil, conn)
+			}, request)
+			if err == nil {
+				t.Fatal("handle() = nil")
+			}
+			want := []byte{5, socksAuthNone, 5, tt.rep, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0}
+			if !bytes.Equal(reply, want) {
+				t.Fatalf("reply = %v, want %v", reply, want)
+			}
+		})
+	}
+}
+
+// socksExchange 由 serve 处理连接,客户端写入 request 后读取代理返回的全部数据
+func socksExchange(t *testing.T, serve func(conn net.Conn) error, request []byte) ([]byte, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := serve(server)
+		_ = server.Close()
+		done <- err
+	}()
+	go func() {
+		_, _ = client.Write(request)
+	}()
+	reply, _ := io.ReadAll(client)
+	_ = client.Close()
+	return reply, <-done
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+)
+
+const (
+	defaultValidatorTimeout  = time.Second * 5
+	defaultAppsWatchInterval = time.Second * 5
+)
+
+// makeValidator 按 Validator.Type 创建 Validator,file 类型同时返回监视凭据文件的 appsFile
+func makeValidator(cfg *config.Config) (silly_ctrl.Validator, *appsFile, error) {
+	vc := &cfg.Validator
+	timeout := time.Duration(vc.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultValidatorTimeout
+	}
+	var lookup silly_ctrl.AppLookup
+	switch vc.Type {
+	case "", config.ValidatorConfig:
+		return silly_ctrl.NewBasicValidator(cfg.Apps), nil, nil
+	case config.ValidatorCert:
+		if cfg.TLS.ClientCA == "" {
+			return nil, nil, fmt.Errorf("cert validator requires TLS.ClientCA")
+		}
+		return silly_ctrl.NewCertValidator(cfg.Apps), nil, nil
+	case config.ValidatorFile:
+		file := &appsFile{filename: vc.Filename}
+		if _, err := file.load(); err != nil {
+			return nil, nil, err
+		}
+		file.validator = silly_ctrl.NewBasicValidator(file.apps)
+		return file.validator, file, nil
+	case config.ValidatorSQL:
+		// 本程序不内置任何数据库驱动,需在编译时以空白导入注册
+		if !slices.Contains(sql.Drivers(), vc.Driver) {
+			return nil, nil, fmt.Errorf("sql driver %q is not compiled in, registered drivers: %v", vc.Driver, sql.Drivers())
+		}
+		db, err := sql.Open(vc.Driver, vc.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err = db.PingContext(ctx); err != nil {
+			_ = db.Close()
+			return nil, nil, err
+		}
+		lookup = silly_ctrl.SQLLookup(db, vc.Query)
+	case config.ValidatorWebhook:
+		if vc.URL == "" {
+			return nil, nil, fmt.Errorf("webhook validator without URL")
+		}
+		return silly_ctrl.NewWebhookValidator(&http.Client{Timeout: timeout}, vc.URL, time.Duration(vc.CacheTTLSeconds)*time.Second), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown validator type %s", vc.Type)
+	}
+	if vc.CacheTTLSeconds > 0 {
+		lookup = silly_ctrl.CachedLookup(lookup, time.Duration(vc.CacheTTLSeconds)*time.Second)
+	}
+	return silly_ctrl.NewLookupValidator(lookup, timeout), nil, nil
+}
+
+// appsFile 独立的凭据文件
+type appsFile struct {
+	filename  string
+	modTime   time.Time
+	size      int64
+	apps      []silly_ctrl.App
+	validator silly_ctrl.Validator
+}
+
+// load 文件修改时间或大小变化时重新读取,返回 App 集合是否变化
+func (file *appsFile) load() (bool, error) {
+	info, err := os.Stat(file.filename)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(file.modTime) && info.Size() == file.size {
+		return false, nil
+	}
+	apps, err := config.LoadApps(file.filename)
+	if err != nil {
+		return false, err
+	}
+	file.modTime, file.size = info.ModTime(), info.Size()
+	changed := !reflect.DeepEqual(apps, file.apps)
+	file.apps = apps
+	return changed, nil
+}
+
+// appsWatcher 定期检查凭据文件,变化时替换 App 集合并关闭受影响的会话
+type appsWatcher struct {
+	cfg  *config.Config
+	node silly_ctrl.Node
+	file *appsFile
+}
+
+func (worker *appsWatcher) Tag() string {
+	return "apps-watcher"
+}
+
+func (worker *appsWatcher) Run(ctx context.Context) error {
+	interval := time.Duration(worker.cfg.Validator.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultAppsWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		changed, err := worker.file.load()
+		if err != nil {
+			worker.cfg.Logger().Error("load apps file error", "filename", worker.file.filename, "err", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		worker.file.validator.(silly_ctrl.AppUpdater).UpdateApps(worker.file.apps)
+		closeAppSessions(worker.cfg.Logger(), worker.node.Manager(), worker.file.apps)
+		worker.cfg.Logger().Info("apps file reloaded", "filename", worker.file.filename, "apps", len(worker.file.apps))
+	}
+}
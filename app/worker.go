@@ -2,9 +2,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/irealing/silly-ctrl"
 	"github.com/irealing/silly-ctrl/app/config"
-	"golang.org/x/sync/errgroup"
+	"log/slog"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 func makeListenWorker(node silly_ctrl.Node, cfg *config.Config) (silly_ctrl.Worker, error) {
@@ -13,9 +21,66 @@ func makeListenWorker(node silly_ctrl.Node, cfg *config.Config) (silly_ctrl.Work
 	}), nil
 }
 
+// 远程连接的状态
+const (
+	remoteConnecting = "connecting"
+	remoteConnected  = "connected"
+	remoteBackoff    = "backoff"
+	remoteAuthFailed = "auth-failed" // 对端拒绝身份且配置了 StopOnAuthError,不再重连
+	remoteStopped    = "stopped"
+)
+
+// remoteStatus 远程连接的状态快照
+type remoteStatus struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	App       string    `json:"app"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Endpoint  string    `json:"endpoint,omitempty"`   // connected 时所连接的地址
+	Session   string    `json:"session,omitempty"`    // connected 时的会话 ID
+	Failures  int       `json:"failures"`             // 连续失败次数
+	LastError string    `json:"last_error,omitempty"` // 最近一次连接失败或断开的原因
+	NextRetry time.Time `json:"next_retry"`           // backoff 时下次重连的时间
+}
+
 type remoteWorker struct {
-	cfg  *config.Config
-	node silly_ctrl.Node
+	cfg     *config.Config
+	node    silly_ctrl.Node
+	mu      sync.Mutex
+	ctx     context.Context
+	wg      sync.WaitGroup
+	remotes map[string]*runningRemote
+}
+
+// runningRemote 运行中的远程连接
+type runningRemote struct {
+	config.Remote
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	status remoteStatus
+}
+
+func (running *runningRemote) Status() remoteStatus {
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	return running.status
+}
+
+func (running *runningRemote) setState(state string, update func(status *remoteStatus)) {
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	running.status.State, running.status.Since = state, time.Now()
+	running.status.Session, running.status.Endpoint, running.status.NextRetry = "", "", time.Time{}
+	if update != nil {
+		update(&running.status)
+	}
+}
+
+// remoteID 远程连接以 AccessKey 与地址区分
+func remoteID(remote *config.Remote) string {
+	return remote.App.AccessKey + "@" + strings.Join(remote.Endpoints(), ",")
 }
 
 func (worker *remoteWorker) Tag() string {
@@ -23,24 +88,303 @@ func (worker *remoteWorker) Tag() string {
 }
 
 func (worker *remoteWorker) Run(ctx context.Context) error {
-	eg, ctx := errgroup.WithContext(ctx)
+	worker.mu.Lock()
+	worker.ctx = ctx
+	worker.remotes = make(map[string]*runningRemote)
 	for _, remote := range worker.cfg.Remote {
-		eg.Go(func() error {
-			return worker.runRemote(ctx, &remote)
-		})
+		worker.start(remote)
+	}
+	worker.mu.Unlock()
+	<-ctx.Done()
+	worker.wg.Wait()
+	return nil
+}
+
+// start 需持有 mu
+func (worker *remoteWorker) start(remote config.Remote) {
+	id := remoteID(&remote)
+	ctx, cancel := context.WithCancel(worker.ctx)
+	running := &runningRemote{Remote: remote, cancel: cancel, done: make(chan struct{})}
+	running.status = remoteStatus{ID: id, Address: remote.Address, App: remote.App.AccessKey, State: remoteConnecting, Since: time.Now()}
+	worker.remotes[id] = running
+	worker.wg.Add(1)
+	go func() {
+		defer worker.wg.Done()
+		defer close(running.done)
+		_ = worker.runRemote(ctx, running)
+	}()
+}
+
+// List 各远程连接的状态,按 ID 排序
+func (worker *remoteWorker) List() []remoteStatus {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	statuses := make([]remoteStatus, 0, len(worker.remotes))
+	for _, running := range worker.remotes {
+		statuses = append(statuses, running.Status())
 	}
-	return eg.Wait()
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+	return statuses
 }
-func (worker *remoteWorker) runRemote(ctx context.Context, remote *config.Remote) error {
+
+// Sync 按重新加载的配置启停远程连接,配置变化的连接将重连,未变化的连接不受影响,已停止重连的连接将重新启动
+func (worker *remoteWorker) Sync(remotes []config.Remote) {
+	want := make(map[string]config.Remote, len(remotes))
+	for _, remote := range remotes {
+		want[remoteID(&remote)] = remote
+	}
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+	if worker.ctx == nil || worker.ctx.Err() != nil {
+		return
+	}
+	for id, running := range worker.remotes {
+		if remote, ok := want[id]; ok && reflect.DeepEqual(remote, running.Remote) && running.Status().State != remoteAuthFailed {
+			delete(want, id)
+			continue
+		}
+		worker.cfg.Logger().Info("stop remote", "remote", running.Address, "app", running.App.AccessKey)
+		running.cancel()
+		<-running.done
+		delete(worker.remotes, id)
+	}
+	for _, remote := range want {
+		worker.cfg.Logger().Info("start remote", "remote", remote.Address, "app", remote.App.AccessKey)
+		worker.start(remote)
+	}
+}
+
+// runRemote 按 Backoff 重连,会话持续 Backoff.ResetSeconds 后断开时重置重连延迟
+// 每轮按 Strategy 尝试全部地址,均失败后等待重连延迟;刚断开的地址在下一轮最后尝试
+func (worker *remoteWorker) runRemote(ctx context.Context, running *runningRemote) error {
+	remote, logger := &running.Remote, worker.cfg.Logger().With("remote", running.Address, "app", running.App.AccessKey)
+	defer running.setState(remoteStopped, nil)
+	if _, err := remote.TLSConfig(worker.cfg.TLSConfig(), ""); err != nil {
+		logger.Error("remote tls config error", "err", err)
+		return err
+	}
+	backoff := worker.cfg.Backoff.Backoff()
+	healthy := time.Duration(worker.cfg.Backoff.ResetSeconds) * time.Second
+	var last string
 	for {
+		running.setState(remoteConnecting, nil)
+		endpoints := worker.resolve(ctx, remote, logger)
+		dialer := &endpointDialer{worker: worker, running: running, logger: logger, endpoints: endpoints, order: dialOrder(endpoints, last)}
+		connectedAt, endpoint, err := dialer.run(ctx)
+		last = endpoint
+		if ctx.Err() != nil {
+			logger.Info("remote done")
+			return nil
+		}
+		if !connectedAt.IsZero() && time.Since(connectedAt) >= healthy {
+			backoff.Reset()
+		}
+		if worker.cfg.Backoff.StopOnAuthError && silly_ctrl.IsAuthFailure(err) {
+			running.setState(remoteAuthFailed, func(status *remoteStatus) {
+				status.Failures++
+				status.LastError = err.Error()
+			})
+			logger.Error("remote rejected authentication, stop reconnecting", "err", err)
+			<-ctx.Done()
+			return err
+		}
+		delay := backoff.Next()
+		running.setState(remoteBackoff, func(status *remoteStatus) {
+			status.Failures++
+			status.LastError = errorString(err)
+			status.NextRetry = time.Now().Add(delay)
+		})
+		logger.Warn("remote disconnected, reconnect later", "err", err, "delay", delay.Round(time.Millisecond))
 		select {
 		case <-ctx.Done():
-			worker.cfg.Logger().Info("remote done", "remote", remote.Address, "app", remote.App.AccessKey)
+			logger.Info("remote done")
 			return nil
-		default:
+		case <-time.After(delay):
+		}
+	}
+}
+
+// resolve 展开 SRV 名称,解析失败的名称被跳过
+func (worker *remoteWorker) resolve(ctx context.Context, remote *config.Remote, logger *slog.Logger) []string {
+	var endpoints []string
+	for _, endpoint := range remote.Endpoints() {
+		if !strings.HasPrefix(endpoint, "_") {
+			endpoints = append(endpoints, endpoint)
+			continue
 		}
-		if err := worker.node.Connect(ctx, remote.Address, &remote.App, worker.cfg.TLSConfig()); err != nil {
-			worker.cfg.Logger().Error("remote connection error", "err", err, "remote", remote.Address, "app", remote.App.AccessKey)
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", endpoint)
+		if err != nil {
+			logger.Warn("lookup srv error", "name", endpoint, "err", err)
+			continue
 		}
+		for _, record := range records {
+			endpoints = append(endpoints, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+	}
+	return endpoints
+}
+
+// dialOrder 本轮首次连接各地址的顺序,last 排在最后,其余保持配置顺序
+func dialOrder(endpoints []string, last string) []int {
+	order := make([]int, 0, len(endpoints))
+	tail := -1
+	for i, endpoint := range endpoints {
+		if endpoint == last && tail < 0 {
+			tail = i
+			continue
+		}
+		order = append(order, i)
+	}
+	if tail >= 0 {
+		order = append(order, tail)
+	}
+	return order
+}
+
+// raceDelay race 策略下尝试下一地址前等待的时间
+const raceDelay = time.Millisecond * 300
+
+type endpointEvent struct {
+	index     int
+	connected bool // false 表示连接失败或会话结束
+	session   silly_ctrl.Session
+	err       error
+}
+
+// endpointDialer 一轮连接,endpoints 为配置顺序,下标越小优先级越高,切回与替换均按该优先级
+type endpointDialer struct {
+	worker     *remoteWorker
+	running    *runningRemote
+	logger     *slog.Logger
+	endpoints  []string
+	order      []int // 首次连接各地址的顺序
+	events     chan endpointEvent
+	cancels    []context.CancelFunc // 进行中的连接,为空表示该地址未在连接
+	active     int                  // 当前会话所在地址的下标,-1 表示无会话
+	next       int                  // order 中下一个待尝试的位置
+	lastErr    error
+	activeAt   time.Time
+	activeAddr string
+}
+
+// run 返回最后一个会话的建立时间、地址与断开原因,全部地址连接失败时建立时间为零值
+func (d *endpointDialer) run(ctx context.Context) (time.Time, string, error) {
+	if len(d.endpoints) < 1 {
+		return time.Time{}, "", fmt.Errorf("%w: no address of remote", silly_ctrl.BadParamError)
+	}
+	d.events = make(chan endpointEvent)
+	d.cancels = make([]context.CancelFunc, len(d.endpoints))
+	d.active = -1
+	race := d.running.Strategy == config.StrategyRace
+	var raceTimer, failback <-chan time.Time
+	if race {
+		raceTimer = time.After(raceDelay)
+	}
+	if d.running.FailbackSeconds > 0 {
+		ticker := time.NewTicker(time.Duration(d.running.FailbackSeconds) * time.Second)
+		defer ticker.Stop()
+		failback = ticker.C
+	}
+	d.dial(ctx, d.order[d.next])
+	d.next++
+	for d.pending() > 0 {
+		select {
+		case event := <-d.events:
+			d.handle(event)
+			if event.connected || d.active >= 0 || ctx.Err() != nil {
+				continue
+			}
+			// 尚未建立会话时,优先级策略在上一个地址失败后尝试下一个
+			if d.activeAt.IsZero() && !race && d.pending() < 1 && d.next < len(d.order) {
+				d.dial(ctx, d.order[d.next])
+				d.next++
+			}
+		case <-raceTimer:
+			if d.active < 0 && d.activeAt.IsZero() && d.next < len(d.order) {
+				d.dial(ctx, d.order[d.next])
+				d.next++
+				raceTimer = time.After(raceDelay)
+			}
+		case <-failback:
+			for i := 0; i < d.active; i++ {
+				if d.cancels[i] == nil {
+					d.dial(ctx, i)
+				}
+			}
+		}
+		if race && d.active < 0 && d.activeAt.IsZero() && d.pending() < 1 && d.next < len(d.order) {
+			d.dial(ctx, d.order[d.next])
+			d.next++
+		}
+	}
+	return d.activeAt, d.activeAddr, d.lastErr
+}
+
+func (d *endpointDialer) pending() int {
+	n := 0
+	for _, cancel := range d.cancels {
+		if cancel != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *endpointDialer) dial(ctx context.Context, index int) {
+	ctx, cancel := context.WithCancel(ctx)
+	d.cancels[index] = cancel
+	remote := &d.running.Remote
+	go func() {
+		tlsConfig, err := remote.TLSConfig(d.worker.cfg.TLSConfig(), d.endpoints[index])
+		if err == nil {
+			err = d.worker.node.ConnectNotify(ctx, d.endpoints[index], &remote.App, tlsConfig, func(sess silly_ctrl.Session) {
+				d.events <- endpointEvent{index: index, connected: true, session: sess}
+			})
+		}
+		d.events <- endpointEvent{index: index, err: err}
+	}()
+}
+
+// handle 首个建立的会话成为当前会话,之后仅更优先地址上的会话(切回)可替换当前会话,其余会话被关闭
+func (d *endpointDialer) handle(event endpointEvent) {
+	endpoint := d.endpoints[event.index]
+	if !event.connected {
+		d.cancels[event.index]()
+		d.cancels[event.index] = nil
+		if event.index == d.active {
+			d.active, d.lastErr = -1, event.err
+		} else if d.activeAt.IsZero() {
+			d.lastErr = event.err
+			d.logger.Debug("remote endpoint failed", "endpoint", endpoint, "err", event.err)
+		}
+		return
+	}
+	if d.active >= 0 && event.index >= d.active {
+		d.cancels[event.index]()
+		return
+	}
+	if d.active >= 0 {
+		d.logger.Info("remote fail back", "from", d.endpoints[d.active], "to", endpoint)
+		d.cancels[d.active]()
+	} else {
+		for i, cancel := range d.cancels {
+			if cancel != nil && i != event.index {
+				cancel()
+			}
+		}
+	}
+	d.active, d.activeAt, d.activeAddr = event.index, time.Now(), endpoint
+	d.running.setState(remoteConnected, func(status *remoteStatus) {
+		status.Session, status.Endpoint, status.Failures, status.LastError = event.session.ID(), endpoint, 0, ""
+	})
+	d.logger.Info("remote connected", "endpoint", endpoint, "session", event.session.ID())
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
 	}
+	return err.Error()
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/app/config"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDialOrder(t *testing.T) {
+	endpoints := []string{"a:1", "b:1", "c:1"}
+	tests := []struct {
+		last string
+		want []int
+	}{
+		{"", []int{0, 1, 2}},
+		{"a:1", []int{1, 2, 0}},
+		{"b:1", []int{0, 2, 1}},
+		{"unknown:1", []int{0, 1, 2}},
+	}
+	for _, tt := range tests {
+		if got := dialOrder(endpoints, tt.last); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("dialOrder(%q) = %v, want %v", tt.last, got, tt.want)
+		}
+	}
+}
+
+// 测试节点中地址的状态
+const (
+	endpointDown = iota // 连接失败
+	endpointUp          // 立即建立会话
+	endpointSlow        // 1 秒后建立会话
+)
+
+// endpointNode 按地址状态模拟 ConnectNotify,会话持续至 ctx 结束
+type endpointNode struct {
+	silly_ctrl.Node
+	mu        sync.Mutex
+	endpoints map[string]int
+	dials     []string
+	closed    []string // 已结束的会话
+}
+
+type stubSession struct {
+	silly_ctrl.Session
+	id string
+}
+
+func (sess *stubSession) ID() string {
+	return sess.id
+}
+
+func (node *endpointNode) set(endpoint string, state int) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.endpoints[endpoint] = state
+}
+
+func (node *endpointNode) snapshot() (dials, closed []string) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return append([]string(nil), node.dials...), append([]string(nil), node.closed...)
+}
+
+func (node *endpointNode) ConnectNotify(ctx context.Context, addr string, _ *silly_ctrl.App, _ *tls.Config, connected func(silly_ctrl.Session)) error {
+	node.mu.Lock()
+	node.dials = append(node.dials, addr)
+	state := node.endpoints[addr]
+	node.mu.Unlock()
+	switch state {
+	case endpointDown:
+		return errors.New("unreachable")
+	case endpointSlow:
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	connected(&stubSession{id: "session-" + addr})
+	<-ctx.Done()
+	node.mu.Lock()
+	node.closed = append(node.closed, addr)
+	node.mu.Unlock()
+	return ctx.Err()
+}
+
+// runDialer 运行一轮 endpointDialer,wait 返回 true 后结束本轮;wait 为空时等待本轮自行结束
+func runDialer(t *testing.T, node *endpointNode, remote config.Remote, last string, wait func(status remoteStatus) bool) (time.Time, string, error) {
+	t.Helper()
+	running := &runningRemote{Remote: remote}
+	endpoints := remote.Endpoints()
+	d := &endpointDialer{
+		worker:    &remoteWorker{cfg: &config.Config{}, node: node},
+		running:   running,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		endpoints: endpoints,
+		order:     dialOrder(endpoints, last),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type result struct {
+		at       time.Time
+		endpoint string
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		at, endpoint, err := d.run(ctx)
+		done <- result{at, endpoint, err}
+	}()
+	deadline := time.After(time.Second * 10)
+	for wait == nil || !wait(running.Status()) {
+		select {
+		case r := <-done:
+			return r.at, r.endpoint, r.err
+		case <-deadline:
+			t.Fatalf("status %+v", running.Status())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	cancel()
+	r := <-done
+	return r.at, r.endpoint, r.err
+}
+
+func connectedTo(endpoint string) func(status remoteStatus) bool {
+	return func(status remoteStatus) bool {
+		return status.State == remoteConnected && status.Endpoint == endpoint
+	}
+}
+
+func TestEndpointDialer(t *testing.T) {
+	remote := config.Remote{Address: "a:1", Addresses: []string{"b:1", "c:1"}}
+	tests := []struct {
+		name      string
+		strategy  string
+		endpoints map[string]int
+		last      string
+		endpoint  string   // 最终连接的地址
+		dials     []string // 尝试连接的顺序
+	}{
+		{"priority", config.StrategyPriority, map[string]int{"b:1": endpointUp, "c:1": endpointUp}, "", "b:1", []string{"a:1", "b:1"}},
+		{"last endpoint tried last", config.StrategyPriority, map[string]int{"a:1": endpointUp, "b:1": endpointUp}, "a:1", "b:1", []string{"b:1"}},
+		{"race", config.StrategyRace, map[string]int{"a:1": endpointSlow, "b:1": endpointUp}, "", "b:1", []string{"a:1", "b:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &endpointNode{endpoints: tt.endpoints}
+			remote := remote
+			remote.Strategy = tt.strategy
+			at, endpoint, _ := runDialer(t, node, remote, tt.last, connectedTo(tt.endpoint))
+			if at.IsZero() || endpoint != tt.endpoint {
+				t.Fatalf("run() = %v, %s, want %s", at, endpoint, tt.endpoint)
+			}
+			if dials, _ := node.snapshot(); !reflect.DeepEqual(dials, tt.dials) {
+				t.Fatalf("dials %v, want %v", dials, tt.dials)
+			}
+		})
+	}
+}
+
+func TestEndpointDialerAllFailed(t *testing.T) {
+	node := &endpointNode{endpoints: map[string]int{}}
+	at, endpoint, err := runDialer(t, node, config.Remote{Address: "a:1", Addresses: []string{"b:1"}}, "", nil)
+	if !at.IsZero() || endpoint != "" || err == nil {
+		t.Fatalf("run() = %v, %q, %v, want failure", at, endpoint, err)
+	}
+	if dials, _ := node.snapshot(); !reflect.DeepEqual(dials, []string{"a:1", "b:1"}) {
+		t.Fatalf("dials %v", dials)
+	}
+}
+
+func TestEndpointDialerFailback(t *testing.T) {
+	node := &endpointNode{endpoints: map[string]int{"b:1": endpointUp}}
+	remote := config.Remote{Address: "a:1", Addresses: []string{"b:1"}, FailbackSeconds: 1}
+	_, endpoint, _ := runDialer(t, node, remote, "", func(status remoteStatus) bool {
+		// 连接备用地址后首选地址恢复
+		if status.Endpoint == "b:1" {
+			node.set("a:1", endpointUp)
+		}
+		return connectedTo("a:1")(status)
+	})
+	if endpoint != "a:1" {
+		t.Fatalf("run() endpoint %s, want a:1", endpoint)
+	}
+	// 切回后关闭备用地址上的会话
+	if _, closed := node.snapshot(); len(closed) < 1 || closed[0] != "b:1" {
+		t.Fatalf("closed %v, want b:1 first", closed)
+	}
+}
@@ -2,24 +2,37 @@ package silly_ctrl
 
 import (
 	"github.com/irealing/silly-ctrl/packet"
+	"sync/atomic"
 )
 
+// AppUpdater 支持运行时替换 App 集合的 Validator
+type AppUpdater interface {
+	UpdateApps(apps []App)
+}
+
 type basicValidator struct {
-	apps map[string]App
+	apps atomic.Pointer[map[string]App]
 }
 
 func NewBasicValidator(apps []App) Validator {
+	b := &basicValidator{}
+	b.UpdateApps(apps)
+	return b
+}
+
+// UpdateApps 整体替换 App 集合,进行中的握手使用替换前的集合
+func (b *basicValidator) UpdateApps(apps []App) {
 	mapping := make(map[string]App)
 	for _, app := range apps {
 		mapping[app.AccessKey] = app
 	}
-	return &basicValidator{apps: mapping}
+	b.apps.Store(&mapping)
 }
 
-func (b *basicValidator) Validate(handshake *packet.Handshake) (*App, error) {
-	app, ok := b.apps[handshake.AccessKey]
+func (b *basicValidator) Validate(handshake *packet.Handshake, hctx *HandshakeContext) (*App, error) {
+	app, ok := (*b.apps.Load())[handshake.AccessKey]
 	if !ok {
 		return nil, UnknownAppError
 	}
-	return &app, app.Validate(handshake)
+	return &app, app.Verify(handshake, hctx)
 }
@@ -0,0 +1,31 @@
+package silly_ctrl
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff 带随机抖动的指数退避,非并发安全
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64 // 小于 1 时按 1 处理
+	Jitter     float64 // 0-1,实际延迟在 [d*(1-Jitter), d] 间随机
+	attempt    int
+}
+
+// Next 返回下一次重试前的延迟
+func (b *Backoff) Next() time.Duration {
+	d := float64(b.Initial) * math.Pow(math.Max(b.Multiplier, 1), float64(b.attempt))
+	if d >= float64(b.Max) {
+		d = float64(b.Max)
+	} else {
+		b.attempt++
+	}
+	return time.Duration(d - d*b.Jitter*rand.Float64())
+}
+
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
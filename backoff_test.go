@@ -0,0 +1,43 @@
+package silly_ctrl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff Backoff
+		want    []time.Duration
+	}{
+		{"exponential", Backoff{Initial: time.Second, Max: time.Second * 10, Multiplier: 2},
+			[]time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 8, time.Second * 10, time.Second * 10}},
+		{"multiplier below one", Backoff{Initial: time.Second, Max: time.Second * 10, Multiplier: 0.5},
+			[]time.Duration{time.Second, time.Second, time.Second}},
+		{"initial above max", Backoff{Initial: time.Minute, Max: time.Second * 10, Multiplier: 2},
+			[]time.Duration{time.Second * 10, time.Second * 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				if got := tt.backoff.Next(); got != want {
+					t.Fatalf("Next() #%d = %s, want %s", i, got, want)
+				}
+			}
+			tt.backoff.Reset()
+			if got := tt.backoff.Next(); got != tt.want[0] {
+				t.Fatalf("Next() after Reset = %s, want %s", got, tt.want[0])
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: time.Second * 8, Multiplier: 2, Jitter: 0.5}
+	for i, base := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 8, time.Second * 8} {
+		if got := b.Next(); got > base || got < base/2 {
+			t.Fatalf("Next() #%d = %s, want within [%s, %s]", i, got, base/2, base)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package silly_ctrl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertIdentities 证书中可映射为 AccessKey 的身份,依次为 Subject CN 与 DNS、URI、Email SAN
+func CertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+	return append(ids, cert.EmailAddresses...)
+}
+
+type certValidator struct {
+	basicValidator
+}
+
+// NewCertValidator 以 TLS 客户端证书确认身份,握手中的 AccessKey 须为证书 CN 或 SAN 之一
+// 客户端以证书握手时不校验 Secret,否则同时校验 Secret;证书链与吊销由 tls.Config 校验
+func NewCertValidator(apps []App) Validator {
+	v := &certValidator{}
+	v.UpdateApps(apps)
+	return v
+}
+
+func (v *certValidator) Validate(handshake *packet.Handshake, hctx *HandshakeContext) (*App, error) {
+	if hctx == nil || len(hctx.PeerCertificates) < 1 {
+		return nil, fmt.Errorf("%w: client certificate required", AuthError)
+	}
+	if !slices.Contains(CertIdentities(hctx.PeerCertificates[0]), handshake.AccessKey) {
+		return nil, fmt.Errorf("%w: client certificate does not match %s", AuthError, handshake.AccessKey)
+	}
+	app, ok := (*v.apps.Load())[handshake.AccessKey]
+	if !ok {
+		return nil, UnknownAppError
+	}
+	if hctx.Version == HandshakeCert {
+		return &app, nil
+	}
+	return &app, app.Verify(handshake, hctx)
+}
+
+// SPKIPin 证书公钥(SubjectPublicKeyInfo)SHA-256 的 base64 编码
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParsePin 解析 base64 或 hex 编码的 SPKI SHA-256,可带 sha256/ 前缀
+func ParsePin(pin string) ([]byte, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	sum, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil {
+		sum, err = base64.StdEncoding.DecodeString(pin)
+	}
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("bad SPKI pin %s", pin)
+	}
+	return sum, nil
+}
+
+// PinnedVerifier 返回用于 tls.Config.VerifyPeerCertificate 的校验函数,需同时设置 InsecureSkipVerify
+// roots 为空时仅比对服务端证书的公钥;否则先以 roots 与 serverName 校验证书链,链中任一证书与 pins 匹配即通过
+func PinnedVerifier(pins [][]byte, roots *x509.CertPool, serverName string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) < 1 {
+			return fmt.Errorf("no server certificate")
+		}
+		candidates := certs[:1]
+		if roots != nil {
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			chains, err := certs[0].Verify(x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates})
+			if err != nil {
+				return err
+			}
+			candidates = nil
+			for _, chain := range chains {
+				candidates = append(candidates, chain...)
+			}
+		}
+		for _, cert := range candidates {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if subtle.ConstantTimeCompare(sum[:], pin) == 1 {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("server certificate %s (pin %s) matches no pin", certs[0].Subject, SPKIPin(certs[0]))
+	}
+}
+
+type revocationList struct {
+	*x509.RevocationList
+	serials map[string]struct{}
+}
+
+// RevocationList 从 PEM 或 DER 格式的 CRL 文件加载的吊销列表,文件修改后重新读取
+type RevocationList struct {
+	files    []string
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	lists    map[string][]*revocationList
+}
+
+func NewRevocationList(files ...string) (*RevocationList, error) {
+	r := &RevocationList{files: files, modTimes: make(map[string]time.Time), lists: make(map[string][]*revocationList)}
+	if _, err := r.refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Refresh 重新读取修改过的 CRL 文件,返回是否有文件变化
+func (r *RevocationList) Refresh() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refresh()
+}
+
+// refresh 需持有 mu,读取失败时返回错误,连接将被拒绝
+func (r *RevocationList) refresh() (bool, error) {
+	changed := false
+	for _, filename := range r.files {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return changed, err
+		}
+		if info.ModTime().Equal(r.modTimes[filename]) {
+			continue
+		}
+		lists, err := loadRevocationLists(filename)
+		if err != nil {
+			return changed, fmt.Errorf("load crl %s: %w", filename, err)
+		}
+		r.lists[filename], r.modTimes[filename] = lists, info.ModTime()
+		changed = true
+	}
+	return changed, nil
+}
+
+func loadRevocationLists(filename string) ([]*revocationList, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var ders [][]byte
+	if bytes.Contains(buf, []byte("-----BEGIN")) {
+		for block, rest := pem.Decode(buf); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type == "X509 CRL" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+	} else {
+		ders = append(ders, buf)
+	}
+	lists := make([]*revocationList, 0, len(ders))
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, err
+		}
+		list := &revocationList{RevocationList: crl, serials: make(map[string]struct{}, len(crl.RevokedCertificateEntries))}
+		for _, entry := range crl.RevokedCertificateEntries {
+			list.serials[string(entry.SerialNumber.Bytes())] = struct{}{}
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// Revoked 检查 cert 是否被 issuer 签发的 CRL 吊销,该 CRL 已过 NextUpdate 时返回错误
+func (r *RevocationList) Revoked(cert, issuer *x509.Certificate) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.refresh(); err != nil {
+		return false, err
+	}
+	now, serial := time.Now(), string(cert.SerialNumber.Bytes())
+	for _, lists := range r.lists {
+		for _, list := range lists {
+			if !bytes.Equal(list.RawIssuer, cert.RawIssuer) || list.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			if !list.NextUpdate.IsZero() && now.After(list.NextUpdate) {
+				return false, fmt.Errorf("crl of %s expired at %s", issuer.Subject, list.NextUpdate.Format(time.RFC3339))
+			}
+			if _, ok := list.serials[serial]; ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ConnectionStater 可获取 TLS 连接状态的会话
+type ConnectionStater interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// VerifyConnection 用于 tls.Config.VerifyConnection,拒绝已校验证书链中被吊销的证书
+func (r *RevocationList) VerifyConnection(state tls.ConnectionState) error {
+	for _, chain := range state.VerifiedChains {
+		for i := 0; i+1 < len(chain); i++ {
+			revoked, err := r.Revoked(chain[i], chain[i+1])
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return fmt.Errorf("certificate %s (serial %s) is revoked", chain[i].Subject, chain[i].SerialNumber)
+			}
+		}
+	}
+	return nil
+}
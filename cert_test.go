@@ -0,0 +1,200 @@
+package silly_ctrl
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePin(t *testing.T) {
+	sum := sha256.Sum256([]byte("spki"))
+	hexPin := hex.EncodeToString(sum[:])
+	var colon []string
+	for i := 0; i < len(hexPin); i += 2 {
+		colon = append(colon, hexPin[i:i+2])
+	}
+	tests := []struct {
+		name string
+		pin  string
+		ok   bool
+	}{
+		{"base64", base64.StdEncoding.EncodeToString(sum[:]), true},
+		{"sha256 prefix", "sha256/" + base64.StdEncoding.EncodeToString(sum[:]), true},
+		{"hex", hexPin, true},
+		{"hex colon", strings.ToUpper(strings.Join(colon, ":")), true},
+		{"spaces", " " + hexPin + "\n", true},
+		{"short", hexPin[:40], false},
+		{"garbage", "not a pin", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePin(tt.pin)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("ParsePin(%q) = %x, want error", tt.pin, got)
+				}
+				return
+			}
+			if err != nil || string(got) != string(sum[:]) {
+				t.Fatalf("ParsePin(%q) = %x, %v, want %x", tt.pin, got, err, sum)
+			}
+		})
+	}
+}
+
+func TestPinnedVerifier(t *testing.T) {
+	ca, caKey, err := CreateCertificate(&CertRequest{CommonName: "ca", CA: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _, err := CreateCertificate(&CertRequest{CommonName: "server", Hosts: []string{"server"}, Server: true, Validity: time.Hour}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := CreateCertificate(&CertRequest{CommonName: "other", Hosts: []string{"server"}, Server: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := func(cert *x509.Certificate) []byte {
+		sum, err := ParsePin(SPKIPin(cert))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	tests := []struct {
+		name       string
+		pins       [][]byte
+		roots      *x509.CertPool
+		serverName string
+		chain      []*x509.Certificate
+		ok         bool
+	}{
+		{"leaf pin", [][]byte{pin(server)}, nil, "", []*x509.Certificate{server}, true},
+		{"leaf mismatch", [][]byte{pin(other)}, nil, "", []*x509.Certificate{server}, false},
+		{"any of pins", [][]byte{pin(other), pin(server)}, nil, "", []*x509.Certificate{server}, true},
+		{"ca pin without roots", [][]byte{pin(ca)}, nil, "", []*x509.Certificate{server, ca}, false},
+		{"ca pin with roots", [][]byte{pin(ca)}, roots, "server", []*x509.Certificate{server}, true},
+		{"untrusted chain", [][]byte{pin(other)}, roots, "server", []*x509.Certificate{other}, false},
+		{"wrong server name", [][]byte{pin(server)}, roots, "example.com", []*x509.Certificate{server}, false},
+		{"no certificate", [][]byte{pin(server)}, nil, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := make([][]byte, 0, len(tt.chain))
+			for _, cert := range tt.chain {
+				raw = append(raw, cert.Raw)
+			}
+			err := PinnedVerifier(tt.pins, tt.roots, tt.serverName)(raw, nil)
+			if tt.ok != (err == nil) {
+				t.Fatalf("verify = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	ca, caKey, err := CreateCertificate(&CertRequest{CommonName: "ca", CA: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 与 ca 同名的另一 CA,其签发的 CRL 不应影响 ca 签发的证书
+	forged, forgedKey, err := CreateCertificate(&CertRequest{CommonName: "ca", CA: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, _, err := CreateCertificate(&CertRequest{CommonName: "good", Client: true, Validity: time.Hour}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, _, err := CreateCertificate(&CertRequest{CommonName: "bad", Client: true, Validity: time.Hour}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := []x509.RevocationListEntry{{SerialNumber: bad.SerialNumber, RevocationTime: time.Now()}}
+	tests := []struct {
+		name     string
+		issuer   *x509.Certificate
+		key      crypto.Signer
+		validity time.Duration
+		cert     *x509.Certificate
+		revoked  bool
+		err      bool
+	}{
+		{"revoked", ca, caKey, time.Hour, bad, true, false},
+		{"not revoked", ca, caKey, time.Hour, good, false, false},
+		{"forged issuer", forged, forgedKey, time.Hour, bad, false, false},
+		{"expired", ca, caKey, time.Nanosecond, good, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crl, err := CreateCRL(tt.issuer, tt.key, 1, revoked, tt.validity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(t.TempDir(), "crl.pem")
+			if err = os.WriteFile(filename, crl, 0600); err != nil {
+				t.Fatal(err)
+			}
+			list, err := NewRevocationList(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+			got, err := list.Revoked(tt.cert, ca)
+			if got != tt.revoked || tt.err != (err != nil) {
+				t.Fatalf("Revoked() = %v, %v, want %v, error %v", got, err, tt.revoked, tt.err)
+			}
+		})
+	}
+}
+
+func TestRevocationListRefresh(t *testing.T) {
+	ca, caKey, err := CreateCertificate(&CertRequest{CommonName: "ca", CA: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := CreateCertificate(&CertRequest{CommonName: "agent", Client: true, Validity: time.Hour}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "crl.pem")
+	write := func(revoked []x509.RevocationListEntry, modTime time.Time) {
+		crl, err := CreateCRL(ca, caKey, 1, revoked, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filename, crl, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write(nil, now.Add(-time.Minute))
+	list, err := NewRevocationList(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := list.Refresh(); changed || err != nil {
+		t.Fatalf("Refresh() = %v, %v, want unchanged", changed, err)
+	}
+	write([]x509.RevocationListEntry{{SerialNumber: cert.SerialNumber, RevocationTime: now}}, now)
+	if changed, err := list.Refresh(); !changed || err != nil {
+		t.Fatalf("Refresh() = %v, %v, want changed", changed, err)
+	}
+	if revoked, err := list.Revoked(cert, ca); !revoked || err != nil {
+		t.Fatalf("Revoked() = %v, %v, want revoked", revoked, err)
+	}
+}
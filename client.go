@@ -0,0 +1,231 @@
+package silly_ctrl
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ShellOptions 交互式 shell 参数
+type ShellOptions struct {
+	Command []string                  // 远端执行的程序,为空时使用远端默认 shell
+	Term    string                    // TERM 环境变量
+	Size    *packet.WindowSize        // 初始窗口大小
+	Resize  <-chan *packet.WindowSize // 窗口大小变化
+	Signals <-chan int32              // 需要转发的信号
+}
+
+// Ping 通过 ECHO ping 模式向会话发送 count 个探测包,返回每个探测包的往返时延
+func Ping(ctx context.Context, sess Session, count int, interval time.Duration) ([]time.Duration, error) {
+	samples := make([]time.Duration, 0, count)
+	err := sess.Exec(ctx, packet.EchoCommand(packet.EchoModePing), func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		reader := packet.NewProtoReader(stream)
+		for seq := 0; seq < count; seq++ {
+			if seq > 0 && interval > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(interval):
+				}
+			}
+			start := time.Now()
+			if _, err := protodelim.MarshalTo(stream, &packet.EchoPing{Seq: uint64(seq), T: start.UnixNano()}); err != nil {
+				return err
+			}
+			pong := &packet.EchoPing{}
+			if err := protodelim.UnmarshalFrom(reader, pong); err != nil {
+				return err
+			}
+			if pong.Seq != uint64(seq) {
+				return BadParamError
+			}
+			samples = append(samples, time.Since(start))
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// Bulk 通过 ECHO bulk 模式向会话发送 size 字节数据,返回对端统计信息及本端耗时
+func Bulk(ctx context.Context, sess Session, size int64) (*packet.EchoStat, time.Duration, error) {
+	stat := &packet.EchoStat{}
+	var elapsed time.Duration
+	err := sess.Exec(ctx, packet.EchoCommand(packet.EchoModeBulk), func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		start := time.Now()
+		if err := CopyWithContext(ctx, io.LimitReader(rand.Reader, size), stream); err != nil && err != io.EOF {
+			return err
+		}
+		if err := stream.Close(); err != nil {
+			return err
+		}
+		if err := protodelim.UnmarshalFrom(packet.NewProtoReader(stream), stat); err != nil {
+			return err
+		}
+		elapsed = time.Since(start)
+		return nil
+	})
+	return stat, elapsed, err
+}
+
+// Shell 在会话对端打开交互式 shell,返回远端进程的退出码
+func Shell(ctx context.Context, sess Session, opts *ShellOptions, stdin io.Reader, stdout io.Writer) (int, error) {
+	code := -1
+	cmd := packet.ShellCommand(opts.Term, opts.Size, opts.Command...)
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		writer := NewFrameWriter(stream)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			_, _ = io.Copy(writer.Writer(packet.FrameType_STDIN), stdin)
+		}()
+		go func() {
+			for {
+				var frame *packet.Frame
+				select {
+				case <-ctx.Done():
+					return
+				case size := <-opts.Resize:
+					frame = &packet.Frame{Type: packet.FrameType_RESIZE, Size: size}
+				case sig := <-opts.Signals:
+					frame = &packet.Frame{Type: packet.FrameType_SIGNAL, Signal: sig}
+				}
+				if err := writer.Write(frame); err != nil {
+					return
+				}
+			}
+		}()
+		reader := packet.NewProtoReader(stream)
+		for {
+			frame := &packet.Frame{}
+			if err := protodelim.UnmarshalFrom(reader, frame); err != nil {
+				return err
+			}
+			switch frame.Type {
+			case packet.FrameType_STDOUT:
+				if _, err := stdout.Write(frame.Data); err != nil {
+					return err
+				}
+			case packet.FrameType_EXIT:
+				code = int(frame.Code)
+				return nil
+			}
+		}
+	})
+	return code, err
+}
+
+// RunCommand 在会话对端执行 EXEC 命令,分别输出 stdout/stderr 并返回执行结果
+func RunCommand(ctx context.Context, sess Session, cmd *packet.Command, stdin io.Reader, stdout, stderr io.Writer) (*packet.ExecResult, error) {
+	var result *packet.ExecResult
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		writer := NewFrameWriter(stream)
+		go func() {
+			if stdin != nil {
+				_, _ = io.Copy(writer.Writer(packet.FrameType_STDIN), stdin)
+			}
+			_ = writer.Write(&packet.Frame{Type: packet.FrameType_STDIN})
+		}()
+		reader := packet.NewProtoReader(stream)
+		for {
+			frame := &packet.Frame{}
+			if err := protodelim.UnmarshalFrom(reader, frame); err != nil {
+				return err
+			}
+			var err error
+			switch frame.Type {
+			case packet.FrameType_STDOUT:
+				_, err = stdout.Write(frame.Data)
+			case packet.FrameType_STDERR:
+				_, err = stderr.Write(frame.Data)
+			case packet.FrameType_RESULT:
+				result = frame.Result
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	return result, err
+}
+
+// GetFile 下载对端的 src 文件或目录至本地 dest,resume 为 true 时从本地 .part 文件续传
+func GetFile(ctx context.Context, sess Session, src, dest string, resume bool) (*TransferStat, error) {
+	var stat *TransferStat
+	err := sess.Exec(ctx, packet.FileGetCommand(src), func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		stop := context.AfterFunc(ctx, func() {
+			stream.CancelRead(quic.StreamErrorCode(ApplicationOver))
+			stream.CancelWrite(quic.StreamErrorCode(ApplicationOver))
+		})
+		defer stop()
+		var err error
+		stat, err = ReceiveFiles(stream, dest, resume)
+		return err
+	})
+	return stat, err
+}
+
+// PutFile 上传本地 src 文件或目录至对端 dest,resume 为 true 时对端从已有的 .part 文件续传
+func PutFile(ctx context.Context, sess Session, src, dest string, resume bool) (*TransferStat, error) {
+	var stat *TransferStat
+	err := sess.Exec(ctx, packet.FilePutCommand(dest, resume), func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		stop := context.AfterFunc(ctx, func() {
+			stream.CancelRead(quic.StreamErrorCode(ApplicationOver))
+			stream.CancelWrite(quic.StreamErrorCode(ApplicationOver))
+		})
+		defer stop()
+		var err error
+		stat, err = SendFiles(stream, src)
+		return err
+	})
+	return stat, err
+}
+
+// FileSystem 在会话对端执行 FS 命令,cmd 由 packet.FsCommand 构造
+func FileSystem(ctx context.Context, sess Session, cmd *packet.Command) ([]*packet.FileInfo, error) {
+	result := &packet.FsResult{}
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		return protodelim.UnmarshalFrom(packet.NewProtoReader(stream), result)
+	})
+	return result.Entries, err
+}
+
+// StatRemote 获取对端文件信息,不跟随符号链接
+func StatRemote(ctx context.Context, sess Session, path string) (*packet.FileInfo, error) {
+	entries, err := FileSystem(ctx, sess, packet.FsCommand(packet.FsOpStat, path))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) < 1 {
+		return nil, BadParamError
+	}
+	return entries[0], nil
+}
+
+// ListRemote 列出对端目录
+func ListRemote(ctx context.Context, sess Session, path string) ([]*packet.FileInfo, error) {
+	return FileSystem(ctx, sess, packet.FsCommand(packet.FsOpList, path))
+}
+
+// MkdirRemote 在对端创建目录,parents 为 true 时同时创建父目录
+func MkdirRemote(ctx context.Context, sess Session, path string, parents bool) error {
+	_, err := FileSystem(ctx, sess, packet.FsCommand(packet.FsOpMkdir, path).SetParam("parents", strconv.FormatBool(parents)))
+	return err
+}
+
+// RemoveRemote 删除对端文件或目录,recursive 为 true 时递归删除
+func RemoveRemote(ctx context.Context, sess Session, path string, recursive bool) error {
+	_, err := FileSystem(ctx, sess, packet.FsCommand(packet.FsOpRemove, path).SetParam("recursive", strconv.FormatBool(recursive)))
+	return err
+}
+
+// RenameRemote 重命名对端文件或目录
+func RenameRemote(ctx context.Context, sess Session, path, newPath string) error {
+	_, err := FileSystem(ctx, sess, packet.FsCommand(packet.FsOpRename, path, newPath))
+	return err
+}
@@ -11,6 +11,12 @@ type Config struct {
 	LocalAddress         string        `json:"local_address"`
 	ConnectionQueueSize  int           `json:"connection_queue_size"` // 连接队列的大小
 	HandshakeTimeout     time.Duration `json:"handshake_timeout"`
+	LegacyHandshake      bool          `json:"legacy_handshake"`      // 是否兼容旧版本(V1)握手,V1 不绑定连接,开启后 SkipVerify 的客户端可被中间人降级
+	MaxSessionsPerApp    int           `json:"max_sessions_per_app"`  // 单个 App 允许的最大会话数,0 为不限制
+	ReplaceSession       bool          `json:"replace_session"`       // 超出会话数限制时关闭最早的会话而非拒绝新会话
+	SelectPolicy         SelectPolicy  `json:"select_policy"`         // 按 AccessKey 选择会话的默认策略
+	NodeID               string        `json:"node_id"`               // 节点标识,为空时启动时随机生成
+	RouteAdvertInterval  time.Duration `json:"route_advert_interval"` // 路由通告间隔(秒),0 为不通告,仅向 App Policy.Advertise 非空的会话通告
 }
 
 func DefaultConfig() *Config {
@@ -20,6 +26,7 @@ func DefaultConfig() *Config {
 		LocalAddress:         "127.0.0.1:0",
 		ConnectionQueueSize:  10,
 		HandshakeTimeout:     15,
+		SelectPolicy:         SelectNewest,
 	}
 }
 func (c *Config) Options(opt ...func(cfg *Config) (*Config, error)) (*Config, error) {
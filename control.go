@@ -0,0 +1,483 @@
+package silly_ctrl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ControlUpgrade 控制 socket 上执行会话命令时 Upgrade 的协议名
+const ControlUpgrade = "silly-ctrl"
+
+// SessionInfo 会话信息,由控制 socket 以 JSON 返回
+type SessionInfo struct {
+	ID          string            `json:"id"`
+	AccessKey   string            `json:"access_key"`
+	RemoteAddr  string            `json:"remote_addr"`
+	IsRemote    bool              `json:"is_remote"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	Streams     int               `json:"streams"`
+	Stats       SessionStats      `json:"stats"`
+	Info        *packet.Heartbeat `json:"info,omitempty"` // 对端最近一次心跳
+}
+
+func NewSessionInfo(sess Session) *SessionInfo {
+	return &SessionInfo{
+		ID:          sess.ID(),
+		AccessKey:   sess.App().AccessKey,
+		RemoteAddr:  sess.RemoteAddr().String(),
+		IsRemote:    sess.IsRemote(),
+		ConnectedAt: sess.ConnectedAt(),
+		Streams:     sess.Streams(),
+		Stats:       sess.Stats(),
+		Info:        sess.Info(),
+	}
+}
+
+// ControlServer 在本地 unix socket 上提供 HTTP 控制接口
+// GET /sessions 列出会话,GET /session?id=<ID> 按会话 ID 或 AccessKey 查询会话
+// POST /kick?id=<ID> 关闭会话,GET /routes 列出路由表
+// /exec?session=<ID> 以 Upgrade 切换协议后,客户端写入 Command,此后连接作为该会话上的 stream 使用
+type ControlServer struct {
+	logger  *slog.Logger
+	manager SessionManager
+	mux     *http.ServeMux
+}
+
+func NewControlServer(logger *slog.Logger, manager SessionManager) *ControlServer {
+	server := &ControlServer{logger: logger, manager: manager, mux: http.NewServeMux()}
+	server.mux.HandleFunc("/sessions", server.sessions)
+	server.mux.HandleFunc("/session", server.session)
+	server.mux.HandleFunc("/kick", server.kick)
+	server.mux.HandleFunc("/routes", server.routes)
+	server.mux.HandleFunc("/exec", server.exec)
+	return server
+}
+
+// HandleFunc 注册额外的控制接口
+func (server *ControlServer) HandleFunc(pattern string, handler func(w http.ResponseWriter, r *http.Request)) {
+	server.mux.HandleFunc(pattern, handler)
+}
+
+// Serve 监听 unix socket 直至 ctx 结束,socket 文件仅当前用户可访问
+func (server *ControlServer) Serve(ctx context.Context, path string) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("control socket %s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return fmt.Errorf("control socket %s is in use", path)
+		}
+		// 清理上次异常退出遗留的 socket 文件
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	listener, err := listenControl(path)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           server.mux,
+		ReadHeaderTimeout: time.Second * 10,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = srv.Close()
+	})
+	defer stop()
+	server.logger.Info("control socket listening", "path", path)
+	if err = srv.Serve(listener); errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (server *ControlServer) sessions(w http.ResponseWriter, _ *http.Request) {
+	sessions := server.manager.List()
+	infos := make([]*SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		infos = append(infos, NewSessionInfo(sess))
+	}
+	WriteControlJSON(w, infos)
+}
+
+func (server *ControlServer) session(w http.ResponseWriter, r *http.Request) {
+	sess, ok := server.manager.Get(r.URL.Query().Get("id"))
+	if !ok {
+		WriteControlError(w, UnknownSessionError)
+		return
+	}
+	WriteControlJSON(w, NewSessionInfo(sess))
+}
+
+func (server *ControlServer) kick(w http.ResponseWriter, r *http.Request) {
+	if !AllowMethod(w, r, http.MethodPost) {
+		return
+	}
+	sess, ok := server.manager.Get(r.URL.Query().Get("id"))
+	if !ok {
+		WriteControlError(w, UnknownSessionError)
+		return
+	}
+	server.logger.Info("kick session", "session", sess.ID(), "app", sess.App().AccessKey)
+	if err := sess.Close(ApplicationOver); err != nil {
+		WriteControlError(w, err)
+		return
+	}
+	WriteControlJSON(w, NewSessionInfo(sess))
+}
+
+func (server *ControlServer) routes(w http.ResponseWriter, _ *http.Request) {
+	routes := server.manager.Routes().Dump()
+	if routes == nil {
+		routes = []Route{}
+	}
+	WriteControlJSON(w, routes)
+}
+
+func (server *ControlServer) exec(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), ControlUpgrade) {
+		WriteControlError(w, BadParamError)
+		return
+	}
+	sess, ok := server.manager.Get(r.URL.Query().Get("session"))
+	if !ok {
+		WriteControlError(w, UnknownSessionError)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		server.logger.Warn("control hijack error", "err", err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + ControlUpgrade + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		return
+	}
+	// rw.Reader 经 http.Server 读取连接,读到 EOF 时取消 r.Context(),客户端关闭写端后转发会被中断
+	buffered, _ := rw.Reader.Peek(rw.Reader.Buffered())
+	reader := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), conn))
+	cmd := &packet.Command{}
+	if err = protodelim.UnmarshalFrom(reader, cmd); err != nil {
+		return
+	}
+	started := false
+	err = sess.Exec(r.Context(), cmd, func(ctx context.Context, ret *packet.Ret, _ Session, stream quic.Stream) error {
+		started = true
+		if _, err := protodelim.MarshalTo(conn, ret); err != nil {
+			return err
+		}
+		return RelayConn(ctx, sess.App().AccessKey, conn, reader, stream)
+	})
+	if !started {
+		_, _ = protodelim.MarshalTo(conn, RetWithError(err))
+	}
+	server.logger.Debug("control exec", "session", sess.ID(), "cmd", cmd.Type, "err", err)
+}
+
+// AllowMethod 请求方法不符时返回 405
+func AllowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeControlRet(w, http.StatusMethodNotAllowed, fmt.Errorf("%w: method %s", BadParamError, r.Method))
+	return false
+}
+
+// WriteControlJSON 以 JSON 返回控制接口的结果
+func WriteControlJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// WriteControlError 以 JSON 格式的 Ret 返回错误,HTTP 状态码按 ErrorNo 区分
+func WriteControlError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, BadParamError):
+		status = http.StatusBadRequest
+	case errors.Is(err, UnknownSessionError):
+		status = http.StatusNotFound
+	case errors.Is(err, PermissionDenied):
+		status = http.StatusForbidden
+	}
+	writeControlRet(w, status, err)
+}
+
+func writeControlRet(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(RetWithError(err))
+}
+
+// ControlClient 经控制 socket 访问运行中的节点
+type ControlClient struct {
+	path   string
+	client *http.Client
+}
+
+func NewControlClient(path string) *ControlClient {
+	client := &ControlClient{path: path}
+	client.client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return client.dial(ctx)
+		},
+	}}
+	return client
+}
+
+func (client *ControlClient) dial(ctx context.Context) (*net.UnixConn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", client.path)
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UnixConn), nil
+}
+
+// Do 请求控制接口,in 不为空时以 JSON 作为请求体,out 不为空时将返回的 JSON 解码至 out
+func (client *ControlClient) Do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, controlURL(path, query), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return controlError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Sessions 列出节点上的全部会话
+func (client *ControlClient) Sessions(ctx context.Context) ([]*SessionInfo, error) {
+	var infos []*SessionInfo
+	return infos, client.Do(ctx, http.MethodGet, "/sessions", nil, nil, &infos)
+}
+
+// Kick 关闭节点上的会话
+func (client *ControlClient) Kick(ctx context.Context, id string) (*SessionInfo, error) {
+	info := &SessionInfo{}
+	return info, client.Do(ctx, http.MethodPost, "/kick", url.Values{"id": {id}}, nil, info)
+}
+
+// Routes 列出节点的路由表
+func (client *ControlClient) Routes(ctx context.Context) ([]Route, error) {
+	var routes []Route
+	return routes, client.Do(ctx, http.MethodGet, "/routes", nil, nil, &routes)
+}
+
+// Session 按会话 ID 或 AccessKey 查找节点上的会话,返回的 Session 经控制 socket 执行命令
+func (client *ControlClient) Session(ctx context.Context, id string) (Session, error) {
+	info := &SessionInfo{}
+	if err := client.Do(ctx, http.MethodGet, "/session", url.Values{"id": {id}}, nil, info); err != nil {
+		return nil, err
+	}
+	return &controlSession{client: client, info: info}, nil
+}
+
+func controlURL(path string, query url.Values) string {
+	u := url.URL{Scheme: "http", Host: ControlUpgrade, Path: path, RawQuery: query.Encode()}
+	return u.String()
+}
+
+func controlError(resp *http.Response) error {
+	ret := &packet.Ret{}
+	if err := json.NewDecoder(resp.Body).Decode(ret); err != nil || ret.ErrNo == NoError.Code() {
+		return fmt.Errorf("%w: control %s", UnknownError, resp.Status)
+	}
+	return ErrorFromRet(ret)
+}
+
+// controlSession 经控制 socket 在节点的会话上执行命令,每次 Exec 使用一个独立的连接,不支持数据报流
+type controlSession struct {
+	client *ControlClient
+	info   *SessionInfo
+}
+
+func (sess *controlSession) ID() string {
+	return sess.info.ID
+}
+
+func (sess *controlSession) RemoteAddr() net.Addr {
+	addr, _ := net.ResolveUDPAddr("udp", sess.info.RemoteAddr)
+	return addr
+}
+
+func (sess *controlSession) IsRemote() bool {
+	return sess.info.IsRemote
+}
+
+func (sess *controlSession) App() *App {
+	return &App{AccessKey: sess.info.AccessKey}
+}
+
+func (sess *controlSession) Info() *packet.Heartbeat {
+	return sess.info.Info
+}
+
+func (sess *controlSession) ConnectedAt() time.Time {
+	return sess.info.ConnectedAt
+}
+
+func (sess *controlSession) Streams() int {
+	return sess.info.Streams
+}
+
+func (sess *controlSession) Stats() SessionStats {
+	return sess.info.Stats
+}
+
+// Exec ctx 结束时关闭连接,节点随之关闭会话上对应的 stream
+func (sess *controlSession) Exec(ctx context.Context, cmd *packet.Command, callback SessionExecCallback) error {
+	conn, err := sess.client.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+	req, err := http.NewRequest(http.MethodGet, controlURL("/exec", url.Values{"session": {sess.info.ID}}), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", ControlUpgrade)
+	if err = req.Write(conn); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return controlError(resp)
+	}
+	if _, err = protodelim.MarshalTo(conn, cmd); err != nil {
+		return fmt.Errorf("write command error %w", err)
+	}
+	var ret packet.Ret
+	if err = protodelim.UnmarshalFrom(reader, &ret); err != nil {
+		return fmt.Errorf("read ret error %w", err)
+	}
+	if err = ErrorFromRet(&ret); err != nil {
+		return err
+	}
+	if callback == nil {
+		return nil
+	}
+	return callback(ctx, &ret, sess, &controlStream{conn: conn, reader: reader, ctx: ctx})
+}
+
+func (sess *controlSession) OpenFlow() (DatagramFlow, error) {
+	return nil, DatagramUnsupported
+}
+
+func (sess *controlSession) AcceptFlow(uint64) (DatagramFlow, error) {
+	return nil, DatagramUnsupported
+}
+
+// Close 经控制 socket 关闭节点上的会话,reason 由节点决定
+func (sess *controlSession) Close(ErrorNo) error {
+	_, err := sess.client.Kick(context.Background(), sess.info.ID)
+	return err
+}
+
+// controlStream 以控制 socket 连接实现 quic.Stream,Close 仅关闭写端
+type controlStream struct {
+	conn   *net.UnixConn
+	reader *bufio.Reader
+	ctx    context.Context
+}
+
+func (stream *controlStream) StreamID() quic.StreamID {
+	return 0
+}
+
+func (stream *controlStream) Read(p []byte) (int, error) {
+	return stream.reader.Read(p)
+}
+
+func (stream *controlStream) CancelRead(quic.StreamErrorCode) {
+	_ = stream.conn.CloseRead()
+}
+
+func (stream *controlStream) SetReadDeadline(t time.Time) error {
+	return stream.conn.SetReadDeadline(t)
+}
+
+func (stream *controlStream) Write(p []byte) (int, error) {
+	return stream.conn.Write(p)
+}
+
+func (stream *controlStream) Close() error {
+	return stream.conn.CloseWrite()
+}
+
+// CancelWrite unix socket 无法重置写端,直接关闭连接
+func (stream *controlStream) CancelWrite(quic.StreamErrorCode) {
+	_ = stream.conn.Close()
+}
+
+func (stream *controlStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *controlStream) SetWriteDeadline(t time.Time) error {
+	return stream.conn.SetWriteDeadline(t)
+}
+
+func (stream *controlStream) SetDeadline(t time.Time) error {
+	return stream.conn.SetDeadline(t)
+}
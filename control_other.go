@@ -0,0 +1,20 @@
+//go:build !unix
+
+package silly_ctrl
+
+import (
+	"net"
+	"os"
+)
+
+func listenControl(path string) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,201 @@
+package silly_ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListenControl(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket permissions")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "control.sock")
+	listener, err := listenControl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket mode = %s, want socket 0600", info.Mode())
+	}
+	// 临时目录在移动后删除
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("dir has %d entries, want only the socket", len(entries))
+	}
+	if err = listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket after Close: %v, want removed", err)
+	}
+}
+
+// echoSession 在 QUIC 连接上执行命令,对端原样返回 stream 上的数据
+type echoSession struct {
+	Session
+	conn quic.Connection
+}
+
+func (sess *echoSession) ID() string {
+	return "sess-1"
+}
+
+func (sess *echoSession) App() *App {
+	return &App{AccessKey: "agent"}
+}
+
+func (sess *echoSession) RemoteAddr() net.Addr {
+	return sess.conn.RemoteAddr()
+}
+
+func (sess *echoSession) IsRemote() bool {
+	return true
+}
+
+func (sess *echoSession) Info() *packet.Heartbeat {
+	return nil
+}
+
+func (sess *echoSession) ConnectedAt() time.Time {
+	return time.Time{}
+}
+
+func (sess *echoSession) Streams() int {
+	return 0
+}
+
+func (sess *echoSession) Stats() SessionStats {
+	return SessionStats{}
+}
+
+func (sess *echoSession) Exec(ctx context.Context, cmd *packet.Command, callback SessionExecCallback) error {
+	if cmd.Type != packet.CommandType_ECHO {
+		return fmt.Errorf("%w: command %s", PermissionDenied, cmd.Type)
+	}
+	stream, err := sess.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	return callback(ctx, &packet.Ret{}, sess, stream)
+}
+
+// singleManager 仅包含一个会话的 SessionManager
+type singleManager struct {
+	SessionManager
+	sess Session
+}
+
+func (manager *singleManager) Get(id string) (Session, bool) {
+	if id != manager.sess.ID() && id != manager.sess.App().AccessKey {
+		return nil, false
+	}
+	return manager.sess, true
+}
+
+func serveControl(t *testing.T, manager SessionManager) *ControlClient {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "control.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewControlServer(slog.New(slog.NewTextHandler(io.Discard, nil)), manager).Serve(ctx, path)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return NewControlClient(path)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("control socket not listening")
+	return nil
+}
+
+func TestControlExecRelay(t *testing.T) {
+	client, server := quicPair(t)
+	// 对端原样返回 stream 上的数据
+	go func() {
+		for {
+			stream, err := server.AcceptStream(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(stream, stream)
+				_ = stream.Close()
+			}()
+		}
+	}()
+	control := serveControl(t, &singleManager{sess: &echoSession{conn: client}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if _, err := control.Session(ctx, "unknown"); !errors.Is(err, UnknownSessionError) {
+		t.Fatalf("Session(unknown) = %v, want %v", err, UnknownSessionError)
+	}
+	sess, err := control.Session(ctx, "agent")
+	if err != nil || sess.ID() != "sess-1" {
+		t.Fatalf("Session(agent) = %v, %v", sess, err)
+	}
+	payload := strings.Repeat("relay ", 10000)
+	var got []byte
+	err = sess.Exec(ctx, &packet.Command{Type: packet.CommandType_ECHO}, func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		if _, err := io.WriteString(stream, payload); err != nil {
+			return err
+		}
+		// 关闭写端后对端返回 EOF,读取至连接结束
+		_ = stream.Close()
+		got, err = io.ReadAll(stream)
+		return err
+	})
+	if err != nil || string(got) != payload {
+		t.Fatalf("Exec() = %d bytes, %v, want %d", len(got), err, len(payload))
+	}
+	// 会话拒绝命令时以 Ret 返回错误,不调用 callback
+	err = sess.Exec(ctx, &packet.Command{Type: packet.CommandType_SHELL}, func(context.Context, *packet.Ret, Session, quic.Stream) error {
+		t.Error("callback called for rejected command")
+		return nil
+	})
+	if !errors.Is(err, PermissionDenied) {
+		t.Fatalf("Exec(SHELL) = %v, want %v", err, PermissionDenied)
+	}
+}
+
+func TestControlExecUpgrade(t *testing.T) {
+	client, _ := quicPair(t)
+	control := serveControl(t, &singleManager{sess: &echoSession{conn: client}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	// 未携带 Upgrade 头时不切换协议
+	err := control.Do(ctx, http.MethodGet, "/exec", url.Values{"session": {"sess-1"}}, nil, nil)
+	if !errors.Is(err, BadParamError) {
+		t.Fatalf("GET /exec = %v, want %v", err, BadParamError)
+	}
+	sess := &controlSession{client: control, info: &SessionInfo{ID: "unknown"}}
+	if err = sess.Exec(ctx, &packet.Command{Type: packet.CommandType_ECHO}, nil); !errors.Is(err, UnknownSessionError) {
+		t.Fatalf("Exec(unknown) = %v, want %v", err, UnknownSessionError)
+	}
+}
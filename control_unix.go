@@ -0,0 +1,47 @@
+//go:build unix
+
+package silly_ctrl
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// listenControl 在 path 同目录下的 0700 临时目录中创建 socket,设为 0600 后移动到 path
+// 其他用户在移动前无法访问临时目录,避免 Listen 与 Chmod 之间被连接,且不修改进程的 umask
+func listenControl(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".control-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	tmp := filepath.Join(dir, "control.sock")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// 移动后由 controlListener 删除 path
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = os.Chmod(tmp, 0600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return &controlListener{Listener: listener, path: path}, nil
+}
+
+type controlListener struct {
+	net.Listener
+	path string
+}
+
+func (l *controlListener) Close() error {
+	err := l.Listener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
@@ -2,8 +2,11 @@ package silly_ctrl
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"github.com/irealing/silly-ctrl/packet"
@@ -22,51 +25,136 @@ type Session interface {
 	IsRemote() bool // IsRemote 是否本地发起的连接
 	App() *App
 	Info() *packet.Heartbeat
+	ConnectedAt() time.Time
+	Streams() int // Streams 当前活跃的 stream 数量
+	Stats() SessionStats
 	Exec(ctx context.Context, cmd *packet.Command, callback SessionExecCallback) error
+	OpenFlow() (DatagramFlow, error)            // OpenFlow 分配本端发起的数据报流,连接不支持 datagram 时返回 DatagramUnsupported
+	AcceptFlow(id uint64) (DatagramFlow, error) // AcceptFlow 注册对端发起的数据报流
+	Close(reason ErrorNo) error
 }
 
+// SessionStats 会话连接的统计信息
+type SessionStats struct {
+	RTT           time.Duration `json:"rtt"` // QUIC 平滑往返时延
+	LostPackets   uint64        `json:"lost_packets"`
+	LastHeartbeat time.Time     `json:"last_heartbeat"` // 最近一次收到心跳的时间,仅接收心跳的一端有值
+}
+
+// DefaultMaxHops FORWARD 未携带 ttl 参数时允许的最大跳数
+const DefaultMaxHops = 8
+
+// SelectPolicy 同一 AccessKey 存在多个会话时的选择策略
+type SelectPolicy string
+
+const (
+	SelectNewest      SelectPolicy = "newest"
+	SelectLeastLoaded SelectPolicy = "least-loaded"
+	SelectRoundRobin  SelectPolicy = "round-robin"
+)
+
 type SessionManager interface {
 	Put(sess Session) error
-	Get(accessKey string) (Session, bool)
-	Del(accessKey string) error
+	Get(id string) (Session, bool) // Get 按会话 ID 查找,未找到时按 AccessKey 以默认策略选择
+	Del(id string) error
+	List() []Session
+	GetByApp(accessKey string) []Session
+	Select(id string, policy SelectPolicy) (Session, bool)
+	NodeID() string // NodeID 本节点标识,用于多跳路由的环路检测
+	Routes() RouteTable
 }
 
 type Service interface {
 	Type() packet.CommandType
 	Invoke(ctx context.Context, command *packet.Command, session Session, manager SessionManager, stream quic.Stream) error
 }
-type ServiceMapping map[packet.CommandType]Service
+type ServiceMapping struct {
+	services     map[packet.CommandType]Service
+	interceptors []ServiceInterceptor
+}
 
-func (mapping ServiceMapping) Invoke(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream) error {
-	var err error
-	if service, ok := mapping[cmd.Type]; ok {
-		err = service.Invoke(ctx, cmd, session, manager, stream)
-	} else {
-		err = UnknownCommandError
+func NewServiceMapping() *ServiceMapping {
+	return &ServiceMapping{services: make(map[packet.CommandType]Service)}
+}
+
+func (mapping *ServiceMapping) Invoke(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream) error {
+	handler := mapping.dispatch
+	for i := len(mapping.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := mapping.interceptors[i], handler
+		handler = func(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream) error {
+			return interceptor(ctx, cmd, session, manager, stream, next)
+		}
 	}
+	err := handler(ctx, cmd, session, manager, stream)
 	_, _ = protodelim.MarshalTo(stream, RetWithError(err))
 	return err
 }
 
-func (mapping ServiceMapping) Type() packet.CommandType {
+func (mapping *ServiceMapping) dispatch(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream) error {
+	service, ok := mapping.services[cmd.Type]
+	if !ok {
+		return UnknownCommandError
+	}
+	if err := session.App().Policy.Check(ctx, cmd); err != nil {
+		return err
+	}
+	return service.Invoke(ctx, cmd, session, manager, stream)
+}
+
+func (mapping *ServiceMapping) Type() packet.CommandType {
 	return packet.CommandType_EMPTY
 }
 
-func (mapping ServiceMapping) Register(services ...Service) ServiceMapping {
+func (mapping *ServiceMapping) Register(services ...Service) *ServiceMapping {
 	for _, service := range services {
-		mapping[service.Type()] = service
+		mapping.services[service.Type()] = service
 	}
 	return mapping
 }
 
+// Use 添加拦截器,先添加的拦截器位于调用链外层
+func (mapping *ServiceMapping) Use(interceptors ...ServiceInterceptor) *ServiceMapping {
+	mapping.interceptors = append(mapping.interceptors, interceptors...)
+	return mapping
+}
+
 type App struct {
 	AccessKey string
-	Secret    string
+	Secret    string  // 作为客户端时为空表示以 TLS 客户端证书握手
+	Policy    *Policy `toml:",omitempty"` // 通过该 App 会话收到的命令的授权策略,为空不限制
 }
 
 func (app *App) Signature() *packet.Handshake {
 	return GenerateAuthToken(app.AccessKey, app.Secret)
 }
+
+// Answer 使用 HMAC-SHA256 应答服务端下发的挑战
+func (app *App) Answer(nonce, exporter []byte) *packet.Handshake {
+	return &packet.Handshake{
+		AccessKey: app.AccessKey,
+		Sign:      hex.EncodeToString(ChallengeSignature(app.Secret, app.AccessKey, nonce, exporter)),
+		Version:   HandshakeV2,
+		Nonce:     nonce,
+	}
+}
+
+// Verify 按握手版本校验签名
+func (app *App) Verify(handshake *packet.Handshake, hctx *HandshakeContext) error {
+	if hctx != nil && hctx.Version == HandshakeCert {
+		return fmt.Errorf("%w: certificate handshake requires a certificate validator", AuthError)
+	}
+	if hctx == nil || hctx.Version < HandshakeV2 {
+		return app.Validate(handshake)
+	}
+	sign, err := hex.DecodeString(handshake.Sign)
+	if err != nil {
+		return HandshakeFailedError
+	}
+	if !hmac.Equal(sign, ChallengeSignature(app.Secret, app.AccessKey, hctx.Nonce, hctx.Exporter)) {
+		return HandshakeFailedError
+	}
+	return nil
+}
 func (app *App) Validate(handshake *packet.Handshake) error {
 	delay := time.Now().Unix() - int64(handshake.T)
 	if delay > 30 || delay < (-30) {
@@ -89,6 +177,16 @@ func GenerateSignatureString(args ...string) string {
 	return hex.EncodeToString(GenerateSignature(args...))
 }
 
+// ChallengeSignature HMAC-SHA256(secret, label|accessKey|nonce|exporter),各字段均带长度前缀
+func ChallengeSignature(secret, accessKey string, nonce, exporter []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, field := range [][]byte{[]byte(handshakeLabel), []byte(accessKey), nonce, exporter} {
+		_ = binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+	return mac.Sum(nil)
+}
+
 func GenerateAuthToken(ak, sk string) *packet.Handshake {
 	t := time.Now().Unix()
 	sign := GenerateSignatureString(ak, sk, fmt.Sprintf("%d", t))
@@ -102,8 +200,27 @@ func GenerateAuthToken(ak, sk string) *packet.Handshake {
 type Node interface {
 	Run(ctx context.Context, tlsConfig *tls.Config) error
 	Connect(ctx context.Context, addr string, app *App, tlsConfig *tls.Config) error
+	// ConnectNotify 同 Connect,握手成功、会话开始运行前调用 connected
+	ConnectNotify(ctx context.Context, addr string, app *App, tlsConfig *tls.Config, connected func(Session)) error
 	Manager() SessionManager
 }
+
+const (
+	HandshakeV1    uint32 = 1 // 基于时间戳的静态签名,可被重放
+	HandshakeV2    uint32 = 2 // 基于随机数与 TLS exporter 的 HMAC 挑战应答
+	HandshakeCert  uint32 = 3 // 仅以 TLS 客户端证书确认身份,不校验 Secret
+	handshakeLabel        = "silly-ctrl handshake v2"
+)
+
+// HandshakeContext 服务端握手时的上下文信息
+type HandshakeContext struct {
+	Version  uint32
+	Nonce    []byte // 服务端下发的随机数
+	Exporter []byte // TLS exporter 导出值,将签名绑定到当前连接
+	// PeerCertificates 客户端证书,经 TLS 校验后有效
+	PeerCertificates []*x509.Certificate
+}
+
 type Validator interface {
-	Validate(handshake *packet.Handshake) (*App, error)
+	Validate(handshake *packet.Handshake, hctx *HandshakeContext) (*App, error)
 }
@@ -0,0 +1,312 @@
+package silly_ctrl
+
+import (
+	"context"
+	"errors"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	MaxPacketSize = 64 * 1024
+	// MaxDatagramSize 经 QUIC datagram 发送的数据报上限,须能放入约 1200 字节的 QUIC 包,否则会被 quic-go 静默丢弃
+	MaxDatagramSize = 1100
+)
+
+// DatagramFlow 基于 QUIC datagram 的数据报流,同一连接上的多个流由 flow ID 区分
+type DatagramFlow interface {
+	ID() uint64
+	Send(p []byte) error
+	Receive(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// PacketPipe 保留数据报边界的双向通道
+type PacketPipe interface {
+	ReadPacket(buf []byte) (int, error)
+	WritePacket(p []byte) error
+	Close() error
+}
+
+type streamPipe struct {
+	stream quic.Stream
+}
+
+// StreamPipe 使用长度前缀在 stream 上传输数据报
+func StreamPipe(stream quic.Stream) PacketPipe {
+	return &streamPipe{stream: stream}
+}
+
+func (pipe *streamPipe) ReadPacket(buf []byte) (int, error) {
+	return ReadPacket(pipe.stream, buf)
+}
+
+func (pipe *streamPipe) WritePacket(p []byte) error {
+	return WritePacket(pipe.stream, p)
+}
+
+func (pipe *streamPipe) Close() error {
+	pipe.stream.CancelRead(quic.StreamErrorCode(NoError))
+	return pipe.stream.Close()
+}
+
+type flowPipe struct {
+	flow    DatagramFlow
+	stream  quic.Stream
+	ctx     context.Context
+	cancel  context.CancelFunc
+	packets chan []byte
+}
+
+// FlowPipe 使用 QUIC datagram 传输数据报,超出 datagram 大小限制的数据报经命令的 stream 以长度前缀帧传输
+// 返回的 ctx 在对端关闭 stream 或数据报流关闭时取消
+func FlowPipe(ctx context.Context, flow DatagramFlow, stream quic.Stream) (context.Context, PacketPipe) {
+	ctx, cancel := context.WithCancel(ctx)
+	pipe := &flowPipe{flow: flow, stream: stream, ctx: ctx, cancel: cancel, packets: make(chan []byte)}
+	go pipe.receive(func() ([]byte, error) {
+		return pipe.flow.Receive(ctx)
+	})
+	go pipe.receive(func() ([]byte, error) {
+		buf := make([]byte, MaxPacketSize)
+		n, err := ReadPacket(pipe.stream, buf)
+		return buf[:n], err
+	})
+	return ctx, pipe
+}
+
+// receive 将 read 读取的数据报送入 packets,出错时取消 ctx
+func (pipe *flowPipe) receive(read func() ([]byte, error)) {
+	defer pipe.cancel()
+	for {
+		data, err := read()
+		if err != nil {
+			return
+		}
+		select {
+		case pipe.packets <- data:
+		case <-pipe.ctx.Done():
+			return
+		}
+	}
+}
+
+func (pipe *flowPipe) ReadPacket(buf []byte) (int, error) {
+	select {
+	case data := <-pipe.packets:
+		return copy(buf, data), nil
+	case <-pipe.ctx.Done():
+		return 0, io.EOF
+	}
+}
+
+func (pipe *flowPipe) WritePacket(p []byte) error {
+	var tooLarge *quic.DatagramTooLargeError
+	if len(p) <= MaxDatagramSize {
+		if err := pipe.flow.Send(p); !errors.As(err, &tooLarge) {
+			return err
+		}
+	}
+	DefaultMetrics.OversizeDatagrams.Add(1)
+	return WritePacket(pipe.stream, p)
+}
+
+func (pipe *flowPipe) Close() error {
+	pipe.cancel()
+	return pipe.flow.Close()
+}
+
+type connPipe struct {
+	conn net.Conn
+}
+
+// ConnPipe 已连接的数据报连接,如 net.Dial("udp", ...) 的返回值
+func ConnPipe(conn net.Conn) PacketPipe {
+	return &connPipe{conn: conn}
+}
+
+func (pipe *connPipe) ReadPacket(buf []byte) (int, error) {
+	return pipe.conn.Read(buf)
+}
+
+func (pipe *connPipe) WritePacket(p []byte) error {
+	_, err := pipe.conn.Write(p)
+	return err
+}
+
+func (pipe *connPipe) Close() error {
+	return pipe.conn.Close()
+}
+
+// RelayPackets 在两个 PacketPipe 之间转发数据报,任一方向出错或超过 idle 无数据时结束并关闭两端
+// 字节数计入 app 的 ForwardedBytes
+func RelayPackets(ctx context.Context, app string, a, b PacketPipe, idle time.Duration) error {
+	var active atomic.Int64
+	active.Store(time.Now().UnixNano())
+	errs := make(chan error, 2)
+	pump := func(src, dst PacketPipe) {
+		buf := make([]byte, MaxPacketSize)
+		for {
+			n, err := src.ReadPacket(buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			active.Store(time.Now().UnixNano())
+			if err = dst.WritePacket(buf[:n]); err != nil {
+				errs <- err
+				return
+			}
+			DefaultMetrics.ForwardedBytes.Add(float64(n), app, "packet")
+		}
+	}
+	go pump(a, b)
+	go pump(b, a)
+	ticker := time.NewTicker(max(idle/4, time.Second))
+	defer ticker.Stop()
+	var err error
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case err = <-errs:
+			break loop
+		case <-ticker.C:
+			if time.Since(time.Unix(0, active.Load())) > idle {
+				break loop
+			}
+		}
+	}
+	_ = a.Close()
+	_ = b.Close()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// PacketTunnel 在会话上执行 network=udp 的 PROXY/FORWARD 命令
+// 优先使用 QUIC datagram,对端不支持时退回 stream 上的长度前缀帧,超出 datagram 大小限制的数据报同样经 stream 传输
+func PacketTunnel(ctx context.Context, sess Session, cmd *packet.Command, fn func(ctx context.Context, pipe PacketPipe) error) error {
+	flow, err := sess.OpenFlow()
+	if err == nil {
+		defer func() {
+			_ = flow.Close()
+		}()
+		cmd.SetParam("flow", strconv.FormatUint(flow.ID(), 10))
+	}
+	return sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ Session, stream quic.Stream) error {
+		if flow == nil {
+			return fn(ctx, StreamPipe(stream))
+		}
+		return fn(FlowPipe(ctx, flow, stream))
+	})
+}
+
+// AcceptPacketPipe 按命令中的 flow 参数接受对端发起的数据报流,未指定时使用 stream 帧
+// 返回的 ctx 在对端关闭 stream 时取消
+func AcceptPacketPipe(ctx context.Context, sess Session, command *packet.Command, stream quic.Stream) (context.Context, PacketPipe, error) {
+	id, ok := command.GetParam("flow")
+	if !ok {
+		return ctx, StreamPipe(stream), nil
+	}
+	flowID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return ctx, nil, BadParamError
+	}
+	flow, err := sess.AcceptFlow(flowID)
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx, pipe := FlowPipe(ctx, flow, stream)
+	return ctx, pipe, nil
+}
+
+type demuxPipe struct {
+	conn   net.PacketConn
+	addr   net.Addr
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+	remove func()
+}
+
+func (pipe *demuxPipe) ReadPacket(buf []byte) (int, error) {
+	select {
+	case data := <-pipe.in:
+		return copy(buf, data), nil
+	case <-pipe.closed:
+		return 0, io.EOF
+	}
+}
+
+func (pipe *demuxPipe) WritePacket(p []byte) error {
+	_, err := pipe.conn.WriteTo(p, pipe.addr)
+	return err
+}
+
+func (pipe *demuxPipe) Close() error {
+	pipe.once.Do(func() {
+		pipe.remove()
+		close(pipe.closed)
+	})
+	return nil
+}
+
+// ServePacketConn 按来源地址拆分 conn 上的数据报,每个新来源调用一次 handle
+// handle 返回后关闭该来源的 PacketPipe,ctx 结束时关闭 conn
+func ServePacketConn(ctx context.Context, conn net.PacketConn, handle func(ctx context.Context, pipe PacketPipe, addr net.Addr)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	var mu sync.Mutex
+	pipes := make(map[string]*demuxPipe)
+	buf := make([]byte, MaxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		key := addr.String()
+		mu.Lock()
+		pipe, ok := pipes[key]
+		if !ok {
+			pipe = &demuxPipe{conn: conn, addr: addr, in: make(chan []byte, 64), closed: make(chan struct{})}
+			pipe.remove = func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if pipes[key] == pipe {
+					delete(pipes, key)
+				}
+			}
+			pipes[key] = pipe
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					_ = pipe.Close()
+				}()
+				handle(ctx, pipe, addr)
+			}()
+		}
+		mu.Unlock()
+		select {
+		case pipe.in <- append([]byte(nil), buf[:n]...):
+		default:
+		}
+	}
+}
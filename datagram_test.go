@@ -0,0 +1,134 @@
+package silly_ctrl
+
+import (
+	"bytes"
+	"context"
+	"github.com/quic-go/quic-go"
+	"io"
+	"testing"
+	"time"
+)
+
+// chanFlow 以 channel 连接的内存 DatagramFlow,超过 limit 的数据报返回 DatagramTooLargeError
+type chanFlow struct {
+	limit int
+	in    chan []byte
+	out   chan []byte
+	sent  int
+}
+
+func chanFlowPair(limit int) (*chanFlow, *chanFlow) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	return &chanFlow{limit: limit, in: a, out: b}, &chanFlow{limit: limit, in: b, out: a}
+}
+
+func (f *chanFlow) ID() uint64 {
+	return 1
+}
+
+func (f *chanFlow) Send(p []byte) error {
+	if len(p) > f.limit {
+		return &quic.DatagramTooLargeError{MaxDatagramPayloadSize: int64(f.limit)}
+	}
+	f.sent++
+	f.out <- append([]byte(nil), p...)
+	return nil
+}
+
+func (f *chanFlow) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-f.in:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *chanFlow) Close() error {
+	return nil
+}
+
+func TestFlowPipeOversize(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int // 数据报流可发送的最大长度
+		size   int
+		flowed bool // 是否经数据报流发送
+	}{
+		{"datagram", MaxDatagramSize, 100, true},
+		{"max datagram", MaxDatagramSize, MaxDatagramSize, true},
+		{"above max datagram", MaxPacketSize, MaxDatagramSize + 1, false},
+		{"too large error", 500, 1000, false},
+		{"max packet", MaxDatagramSize, MaxPacketSize - 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := quicPair(t)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			stream, err := client.OpenStreamSync(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 对端在收到数据后才能接受 stream
+			if err = WritePacket(stream, []byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			peer, err := server.AcceptStream(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			localFlow, peerFlow := chanFlowPair(tt.limit)
+			_, local := FlowPipe(ctx, localFlow, stream)
+			_, remote := FlowPipe(ctx, peerFlow, peer)
+			buf := make([]byte, MaxPacketSize)
+			if n, err := remote.ReadPacket(buf); err != nil || string(buf[:n]) != "hello" {
+				t.Fatalf("ReadPacket() = %q, %v", buf[:n], err)
+			}
+			p := bytes.Repeat([]byte{'x'}, tt.size)
+			if err = local.WritePacket(p); err != nil {
+				t.Fatalf("WritePacket(%d bytes) = %v", tt.size, err)
+			}
+			n, err := remote.ReadPacket(buf)
+			if err != nil || !bytes.Equal(buf[:n], p) {
+				t.Fatalf("ReadPacket() = %d bytes, %v, want %d", n, err, tt.size)
+			}
+			if flowed := localFlow.sent > 0; flowed != tt.flowed {
+				t.Fatalf("sent on flow = %v, want %v", flowed, tt.flowed)
+			}
+		})
+	}
+}
+
+func TestFlowPipeStreamClosed(t *testing.T) {
+	client, server := quicPair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	stream, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WritePacket(stream, nil); err != nil {
+		t.Fatal(err)
+	}
+	peer, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, peerFlow := chanFlowPair(MaxDatagramSize)
+	pipeCtx, remote := FlowPipe(ctx, peerFlow, peer)
+	buf := make([]byte, MaxPacketSize)
+	if _, err = remote.ReadPacket(buf); err != nil {
+		t.Fatal(err)
+	}
+	// 发起方关闭 stream 后 ctx 取消,ReadPacket 返回 EOF
+	_ = stream.Close()
+	select {
+	case <-pipeCtx.Done():
+	case <-ctx.Done():
+		t.Fatal("FlowPipe ctx not canceled after stream closed")
+	}
+	if _, err = remote.ReadPacket(buf); err != io.EOF {
+		t.Fatalf("ReadPacket() = %v, want %v", err, io.EOF)
+	}
+}
@@ -1,5 +1,10 @@
 package silly_ctrl
 
+import (
+	"errors"
+	"github.com/quic-go/quic-go"
+)
+
 type ErrorNo uint64
 
 const (
@@ -14,6 +19,13 @@ const (
 	ApplicationOver
 	UnknownSessionError
 	UnknownError
+	SessionReplaced
+	PermissionDenied
+	DatagramUnsupported
+	RouteLoopError
+	HopLimitError
+	ChecksumError
+	ValidatorUnavailable
 )
 
 func (e ErrorNo) Code() uint64 {
@@ -33,10 +45,28 @@ func (e ErrorNo) String() string {
 		return "handshake failed"
 	case UnknownCommandError:
 		return "unknown command"
+	case BadParamError:
+		return "bad param"
 	case SessionAlreadyExists:
 		return "session already exists"
 	case ApplicationOver:
 		return "application over"
+	case UnknownSessionError:
+		return "unknown session"
+	case SessionReplaced:
+		return "session replaced"
+	case PermissionDenied:
+		return "permission denied"
+	case DatagramUnsupported:
+		return "datagram unsupported"
+	case RouteLoopError:
+		return "route loop"
+	case HopLimitError:
+		return "hop limit exceeded"
+	case ChecksumError:
+		return "checksum mismatch"
+	case ValidatorUnavailable:
+		return "validator unavailable"
 	default:
 		return "unknown"
 	}
@@ -44,3 +74,29 @@ func (e ErrorNo) String() string {
 func (e ErrorNo) Error() string {
 	return e.String()
 }
+
+// ConnectionErrorNo 提取 ErrorNo,包括对端以 ErrorNo 为错误码关闭连接的情况
+func ConnectionErrorNo(err error) (ErrorNo, bool) {
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote {
+		return ErrorNo(appErr.ErrorCode), true
+	}
+	var errNo ErrorNo
+	if errors.As(err, &errNo) {
+		return errNo, true
+	}
+	return 0, false
+}
+
+// IsAuthFailure 对端拒绝了本端的身份:App 未知、签名错误或 TLS 证书被对端拒绝,重试无法恢复
+// 签名超时可由时钟偏差引起,本端校验对端证书失败(如证书轮换)也可能恢复,对端凭据后端不可用(ValidatorUnavailable)可重试,均不计入
+func IsAuthFailure(err error) bool {
+	if errNo, ok := ConnectionErrorNo(err); ok {
+		switch errNo {
+		case AuthError, UnknownAppError, HandshakeFailedError:
+			return true
+		}
+	}
+	var transportErr *quic.TransportError
+	return errors.As(err, &transportErr) && transportErr.Remote && transportErr.ErrorCode.IsCryptoError()
+}
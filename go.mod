@@ -3,6 +3,7 @@ module github.com/irealing/silly-ctrl
 go 1.21.6
 
 require (
+	github.com/creack/pty v1.1.21
 	github.com/irealing/silly-kits v0.0.5
 	github.com/pelletier/go-toml/v2 v2.2.2
 	github.com/quic-go/quic-go v0.43.1
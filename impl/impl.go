@@ -6,9 +6,9 @@ import (
 	"log/slog"
 )
 
-func DefaultServices() sillyctrl.ServiceMapping {
+func DefaultServices() *sillyctrl.ServiceMapping {
 	return internal.CreateServiceMapping()
 }
-func CreateNode(logger *slog.Logger, cfg *sillyctrl.Config, valid sillyctrl.Validator, services sillyctrl.ServiceMapping) (sillyctrl.Node, error) {
+func CreateNode(logger *slog.Logger, cfg *sillyctrl.Config, valid sillyctrl.Validator, services *sillyctrl.ServiceMapping) (sillyctrl.Node, error) {
 	return internal.CreateNode(logger, cfg, valid, services)
 }
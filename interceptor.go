@@ -0,0 +1,54 @@
+package silly_ctrl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+type ServiceHandler func(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream) error
+
+// ServiceInterceptor 包装 Service.Invoke,调用 next 继续执行调用链
+type ServiceInterceptor func(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream, next ServiceHandler) error
+
+// RecoveryInterceptor 捕获 Service 中的 panic 并转换为 UnknownError
+func RecoveryInterceptor(logger *slog.Logger) ServiceInterceptor {
+	return func(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream, next ServiceHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("service panic", "type", cmd.Type, "session", session.ID(), "panic", r, "stack", string(debug.Stack()))
+				err = fmt.Errorf("%w: panic %v", UnknownError, r)
+			}
+		}()
+		return next(ctx, cmd, session, manager, stream)
+	}
+}
+
+// AccessLogInterceptor 记录每个命令的调用方、参数、耗时与结果
+func AccessLogInterceptor(logger *slog.Logger) ServiceInterceptor {
+	return TimingInterceptor(func(cmd *packet.Command, session Session, elapsed time.Duration, err error) {
+		level := slog.LevelInfo
+		if err != nil && !errors.Is(err, NoError) {
+			level = slog.LevelWarn
+		}
+		logger.Log(context.Background(), level, "access",
+			"type", cmd.Type, "args", cmd.Args, "session", session.ID(), "app", session.App().AccessKey,
+			"remote", session.RemoteAddr(), "elapsed", elapsed, "err", err,
+		)
+	})
+}
+
+// TimingInterceptor 在命令执行结束后回调 observe
+func TimingInterceptor(observe func(cmd *packet.Command, session Session, elapsed time.Duration, err error)) ServiceInterceptor {
+	return func(ctx context.Context, cmd *packet.Command, session Session, manager SessionManager, stream quic.Stream, next ServiceHandler) error {
+		start := time.Now()
+		err := next(ctx, cmd, session, manager, stream)
+		observe(cmd, session, time.Since(start), err)
+		return err
+	}
+}
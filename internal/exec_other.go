@@ -0,0 +1,15 @@
+//go:build !unix
+
+package internal
+
+import (
+	"os"
+)
+
+func processSignal(_ *os.ProcessState) int32 {
+	return 0
+}
+
+func maxRSS(_ *os.ProcessState) int64 {
+	return 0
+}
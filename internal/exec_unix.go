@@ -0,0 +1,28 @@
+//go:build unix
+
+package internal
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func processSignal(state *os.ProcessState) int32 {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return int32(status.Signal())
+	}
+	return 0
+}
+
+// maxRSS 进程最大常驻内存,单位 KB
+func maxRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss) / 1024
+	}
+	return int64(usage.Maxrss)
+}
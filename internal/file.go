@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"os"
+	"strconv"
+)
+
+// fileGetService FILE_GET <PATH>,向命令发起方发送文件或目录
+type fileGetService struct {
+}
+
+func (fileGetService) Type() packet.CommandType {
+	return packet.CommandType_FILE_GET
+}
+
+func (fileGetService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+	if len(command.Args) < 1 {
+		return silly_ctrl.BadParamError
+	}
+	src, err := sess.App().Policy.ResolvePath(command.Args[0], true)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		return err
+	}
+	stat, err := silly_ctrl.SendFiles(stream, src)
+	sessionLogger(sess).Info("file get", "session", sess.ID(), "path", src, "files", stat.Files, "bytes", stat.Bytes, "resumed", stat.Resumed, "err", err)
+	return err
+}
+
+// filePutService FILE_PUT <PATH> [resume=true],接收命令发起方发送的文件或目录
+type filePutService struct {
+}
+
+func (filePutService) Type() packet.CommandType {
+	return packet.CommandType_FILE_PUT
+}
+
+func (filePutService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+	if len(command.Args) < 1 {
+		return silly_ctrl.BadParamError
+	}
+	dest, err := sess.App().Policy.ResolvePath(command.Args[0], true)
+	if err != nil {
+		return err
+	}
+	resume, _ := strconv.ParseBool(command.GetParamWithDefault("resume", "false"))
+	if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		return err
+	}
+	stat, err := silly_ctrl.ReceiveFiles(stream, dest, resume)
+	sessionLogger(sess).Info("file put", "session", sess.ID(), "path", dest, "files", stat.Files, "bytes", stat.Bytes, "resumed", stat.Resumed, "err", err)
+	return err
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+	"io"
+	"sync"
+)
+
+// flowTable 会话上的数据报流,datagram 格式为 varint flow ID + 数据
+// 发起连接的一端使用奇数 ID,接受连接的一端使用偶数 ID,双方分配互不冲突
+type flowTable struct {
+	mu    sync.Mutex
+	flows map[uint64]*flow
+	next  uint64
+}
+
+type flow struct {
+	id     uint64
+	conn   quic.Connection
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+	remove func()
+}
+
+func (f *flow) ID() uint64 {
+	return f.id
+}
+
+func (f *flow) Send(p []byte) error {
+	select {
+	case <-f.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	buf := make([]byte, 0, quicvarint.Len(f.id)+len(p))
+	return f.conn.SendDatagram(append(quicvarint.Append(buf, f.id), p...))
+}
+
+func (f *flow) Receive(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-f.in:
+		return data, nil
+	case <-f.closed:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *flow) Close() error {
+	f.once.Do(func() {
+		f.remove()
+		close(f.closed)
+	})
+	return nil
+}
+
+func (sess *session) flowParity() uint64 {
+	if sess.isRemote {
+		return 1
+	}
+	return 0
+}
+
+func (sess *session) OpenFlow() (silly_ctrl.DatagramFlow, error) {
+	if !sess.conn.ConnectionState().SupportsDatagrams {
+		return nil, silly_ctrl.DatagramUnsupported
+	}
+	sess.flows.mu.Lock()
+	defer sess.flows.mu.Unlock()
+	id := sess.flows.next*2 + sess.flowParity()
+	sess.flows.next++
+	return sess.addFlow(id), nil
+}
+
+func (sess *session) AcceptFlow(id uint64) (silly_ctrl.DatagramFlow, error) {
+	if !sess.conn.ConnectionState().SupportsDatagrams {
+		return nil, silly_ctrl.DatagramUnsupported
+	}
+	if id%2 == sess.flowParity() {
+		return nil, silly_ctrl.BadParamError
+	}
+	sess.flows.mu.Lock()
+	defer sess.flows.mu.Unlock()
+	if _, ok := sess.flows.flows[id]; ok {
+		return nil, silly_ctrl.BadParamError
+	}
+	return sess.addFlow(id), nil
+}
+
+// addFlow 调用方需持有 flows.mu
+func (sess *session) addFlow(id uint64) *flow {
+	if sess.flows.flows == nil {
+		sess.flows.flows = make(map[uint64]*flow)
+	}
+	f := &flow{id: id, conn: sess.conn, in: make(chan []byte, 64), closed: make(chan struct{})}
+	f.remove = func() {
+		sess.flows.mu.Lock()
+		defer sess.flows.mu.Unlock()
+		delete(sess.flows.flows, id)
+	}
+	sess.flows.flows[id] = f
+	return f
+}
+
+// receiveDatagram 按 flow ID 分发 datagram,未知 flow 或接收队列已满时丢弃
+func (sess *session) receiveDatagram(ctx context.Context) error {
+	if !sess.conn.ConnectionState().SupportsDatagrams {
+		return nil
+	}
+	for {
+		data, err := sess.conn.ReceiveDatagram(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+		reader := bytes.NewReader(data)
+		id, err := quicvarint.Read(reader)
+		if err != nil {
+			continue
+		}
+		payload := data[len(data)-reader.Len():]
+		sess.flows.mu.Lock()
+		f, ok := sess.flows.flows[id]
+		sess.flows.mu.Unlock()
+		if !ok {
+			continue
+		}
+		select {
+		case f.in <- payload:
+		default:
+		}
+	}
+}
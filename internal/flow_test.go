@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"github.com/quic-go/quic-go"
+	"testing"
+	"time"
+)
+
+// sessionPair 在回环地址上建立启用 datagram 的连接,返回发起方与接受方的会话
+func sessionPair(t *testing.T) (remote, local *session) {
+	t.Helper()
+	cert, key, err := silly_ctrl.CreateCertificate(&silly_ctrl.CertRequest{CommonName: "localhost", Hosts: []string{"127.0.0.1"}, Server: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quicConfig := &quic.Config{EnableDatagrams: true}
+	listener, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}}, quicConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	client, err := quic.DialAddr(ctx, listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}, quicConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.CloseWithError(0, "")
+		_ = server.CloseWithError(0, "")
+		_ = listener.Close()
+	})
+	return &session{conn: client, isRemote: true}, &session{conn: server}
+}
+
+func TestFlowIDs(t *testing.T) {
+	remote, local := sessionPair(t)
+	for i, want := range []uint64{1, 3, 5} {
+		flow, err := remote.OpenFlow()
+		if err != nil || flow.ID() != want {
+			t.Fatalf("remote OpenFlow() #%d = %v, %v, want ID %d", i, flow, err, want)
+		}
+	}
+	for i, want := range []uint64{0, 2} {
+		flow, err := local.OpenFlow()
+		if err != nil || flow.ID() != want {
+			t.Fatalf("local OpenFlow() #%d = %v, %v, want ID %d", i, flow, err, want)
+		}
+	}
+	// 只能接受对端分配的 ID,且同一 ID 不能重复接受
+	if _, err := local.AcceptFlow(4); !errors.Is(err, silly_ctrl.BadParamError) {
+		t.Fatalf("AcceptFlow(own parity) = %v, want %v", err, silly_ctrl.BadParamError)
+	}
+	flow, err := local.AcceptFlow(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = local.AcceptFlow(7); !errors.Is(err, silly_ctrl.BadParamError) {
+		t.Fatalf("AcceptFlow(duplicate) = %v, want %v", err, silly_ctrl.BadParamError)
+	}
+	_ = flow.Close()
+	if _, err = local.AcceptFlow(7); err != nil {
+		t.Fatalf("AcceptFlow() after Close = %v", err)
+	}
+}
+
+func TestFlowDemux(t *testing.T) {
+	remote, local := sessionPair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	go func() {
+		_ = local.receiveDatagram(ctx)
+	}()
+	a, err := remote.OpenFlow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := remote.OpenFlow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerA, err := local.AcceptFlow(a.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerB, err := local.AcceptFlow(b.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未被接受的 flow 的数据报被丢弃,不影响其他 flow
+	unknown, err := remote.OpenFlow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, send := range []struct {
+		flow silly_ctrl.DatagramFlow
+		data string
+	}{{unknown, "dropped"}, {b, "to b"}, {a, "to a"}} {
+		if err = send.flow.Send([]byte(send.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, recv := range []struct {
+		flow silly_ctrl.DatagramFlow
+		want string
+	}{{peerA, "to a"}, {peerB, "to b"}} {
+		data, err := recv.flow.Receive(ctx)
+		if err != nil || string(data) != recv.want {
+			t.Fatalf("flow %d Receive() = %q, %v, want %q", recv.flow.ID(), data, err, recv.want)
+		}
+	}
+	_ = a.Close()
+	if err = a.Send([]byte("closed")); err == nil {
+		t.Fatal("Send() after Close = nil")
+	}
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// fsService FS <OP> <PATH> [NEWPATH],路径经 App 策略的 Root 映射,结果以 FsResult 返回
+type fsService struct {
+}
+
+func (fsService) Type() packet.CommandType {
+	return packet.CommandType_FS
+}
+
+func (service fsService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+	if len(command.Args) < 2 {
+		return silly_ctrl.BadParamError
+	}
+	policy := sess.App().Policy
+	op := command.Args[0]
+	// 删除与重命名作用于符号链接本身,list 需跟随符号链接目录
+	path, err := policy.ResolvePath(command.Args[1], op == packet.FsOpList)
+	if err != nil {
+		return err
+	}
+	if op == packet.FsOpRemove || op == packet.FsOpRename {
+		// 不允许删除或移动根目录本身
+		if root, err := policy.ResolvePath(string(filepath.Separator), true); err != nil || path == root {
+			return silly_ctrl.PermissionDenied
+		}
+	}
+	result := &packet.FsResult{}
+	switch op {
+	case packet.FsOpStat:
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		result.Entries = append(result.Entries, fileInfo(path, info))
+	case packet.FsOpList:
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			result.Entries = append(result.Entries, fileInfo(filepath.Join(path, entry.Name()), info))
+		}
+	case packet.FsOpMkdir:
+		if parents, _ := strconv.ParseBool(command.GetParamWithDefault("parents", "false")); parents {
+			err = os.MkdirAll(path, 0755)
+		} else {
+			err = os.Mkdir(path, 0755)
+		}
+		if err != nil {
+			return err
+		}
+	case packet.FsOpRemove:
+		if recursive, _ := strconv.ParseBool(command.GetParamWithDefault("recursive", "false")); recursive {
+			err = os.RemoveAll(path)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return err
+		}
+	case packet.FsOpRename:
+		if len(command.Args) < 3 {
+			return silly_ctrl.BadParamError
+		}
+		newPath, err := policy.ResolvePath(command.Args[2], false)
+		if err != nil {
+			return err
+		}
+		if err = os.Rename(path, newPath); err != nil {
+			return err
+		}
+	default:
+		return silly_ctrl.BadParamError
+	}
+	if _, err = protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		return err
+	}
+	_, err = protodelim.MarshalTo(stream, result)
+	return err
+}
+
+func fileInfo(path string, info fs.FileInfo) *packet.FileInfo {
+	fi := &packet.FileInfo{
+		Name:  info.Name(),
+		Size:  uint64(info.Size()),
+		Mode:  uint32(info.Mode()),
+		Mtime: info.ModTime().UnixNano(),
+		Dir:   info.IsDir(),
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		fi.Link, _ = os.Readlink(path)
+	}
+	return fi
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"sync"
+	"time"
+)
+
+const (
+	nonceSize      = 32
+	exporterLabel  = "EXPORTER-silly-ctrl-handshake"
+	exporterLength = 32
+	legacyWindow   = time.Second * 61 // 旧版本签名的有效窗口为 ±30 秒
+	maxReplay      = 100000           // replayCache 的最大条目数
+)
+
+// errLegacyServer 对端为仅支持 V1 签名的旧版本节点
+var errLegacyServer = fmt.Errorf("%w: remote node only supports legacy handshake", silly_ctrl.HandshakeFailedError)
+
+// replayCache 记录已通过校验的 V1 签名,拒绝重放
+type replayCache struct {
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	queue replayQueue
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[string]struct{})}
+}
+
+// Add 记录 key,若 key 已存在且未过期或缓存已满返回 false
+func (cache *replayCache) Add(key string, ttl time.Duration) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	now := time.Now()
+	for len(cache.queue) > 0 && now.After(cache.queue[0].expire) {
+		delete(cache.seen, heap.Pop(&cache.queue).(replayEntry).key)
+	}
+	if _, ok := cache.seen[key]; ok || len(cache.seen) >= maxReplay {
+		return false
+	}
+	cache.seen[key] = struct{}{}
+	heap.Push(&cache.queue, replayEntry{key: key, expire: now.Add(ttl)})
+	return true
+}
+
+type replayEntry struct {
+	key    string
+	expire time.Time
+}
+
+// replayQueue 按过期时间排序的最小堆
+type replayQueue []replayEntry
+
+func (q replayQueue) Len() int           { return len(q) }
+func (q replayQueue) Less(i, j int) bool { return q[i].expire.Before(q[j].expire) }
+func (q replayQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *replayQueue) Push(x any)        { *q = append(*q, x.(replayEntry)) }
+func (q *replayQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+func exportKeyingMaterial(conn quic.Connection) ([]byte, error) {
+	state := conn.ConnectionState().TLS
+	return state.ExportKeyingMaterial(exporterLabel, nil, exporterLength)
+}
+
+func (server *ctrlNode) handshake(ctx context.Context, conn quic.Connection) (*silly_ctrl.App, *packet.Handshake, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	authStream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		authStream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
+		if err := authStream.Close(); err != nil {
+			server.logger.Error("close auth stream error", "err", err)
+		}
+	}()
+	if err = authStream.SetReadDeadline(time.Now().Add(time.Second * server.cfg.HandshakeTimeout)); err != nil {
+		return nil, nil, silly_ctrl.AuthError
+	}
+	reader := packet.NewProtoReader(authStream)
+	hs := &packet.Handshake{}
+	if err = protodelim.UnmarshalFrom(reader, hs); err != nil {
+		return nil, nil, err
+	}
+	hctx := &silly_ctrl.HandshakeContext{Version: silly_ctrl.HandshakeV1}
+	if hs.Version == silly_ctrl.HandshakeCert {
+		hctx.Version = silly_ctrl.HandshakeCert
+		_, err = protodelim.MarshalTo(authStream, &packet.Challenge{
+			ErrNo:   silly_ctrl.NoError.Code(),
+			Msg:     silly_ctrl.NoError.String(),
+			Version: silly_ctrl.HandshakeCert,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if hs.Version < silly_ctrl.HandshakeV2 {
+		if !server.cfg.LegacyHandshake {
+			return nil, nil, silly_ctrl.HandshakeFailedError
+		}
+	} else if hctx, hs, err = server.challenge(conn, authStream, reader, hs); err != nil {
+		return nil, nil, err
+	}
+	hctx.PeerCertificates = conn.ConnectionState().TLS.PeerCertificates
+	app, err := server.valid.Validate(hs, hctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// V1 签名不绑定连接,校验通过后才记录,避免未认证的对端占满缓存
+	if hctx.Version == silly_ctrl.HandshakeV1 && !server.replay.Add(hs.AccessKey+":"+hs.Sign, legacyWindow) {
+		server.logger.Warn("legacy handshake replayed", "app", hs.AccessKey, "addr", conn.RemoteAddr())
+		return nil, nil, silly_ctrl.HandshakeFailedError
+	}
+	_, err = protodelim.MarshalTo(authStream, &packet.Ret{
+		ErrNo: silly_ctrl.NoError.Code(),
+		Msg:   silly_ctrl.NoError.String(),
+	})
+
+	if err != nil {
+		server.logger.Warn("write handshake ret failed", "err", err)
+	}
+	return app, hs, err
+}
+
+// challenge 下发随机数并读取客户端的 HMAC 应答
+func (server *ctrlNode) challenge(conn quic.Connection, stream quic.Stream, reader protodelim.Reader, hello *packet.Handshake) (*silly_ctrl.HandshakeContext, *packet.Handshake, error) {
+	exporter, err := exportKeyingMaterial(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	_, err = protodelim.MarshalTo(stream, &packet.Challenge{
+		ErrNo:   silly_ctrl.NoError.Code(),
+		Msg:     silly_ctrl.NoError.String(),
+		Version: silly_ctrl.HandshakeV2,
+		Nonce:   nonce,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	answer := &packet.Handshake{}
+	if err = protodelim.UnmarshalFrom(reader, answer); err != nil {
+		return nil, nil, err
+	}
+	// nonce 由本端随机生成且签名绑定当前连接的 exporter,应答无法在其他连接重放,无需记录
+	if answer.AccessKey != hello.AccessKey || !bytes.Equal(answer.Nonce, nonce) {
+		return nil, nil, silly_ctrl.HandshakeFailedError
+	}
+	return &silly_ctrl.HandshakeContext{Version: silly_ctrl.HandshakeV2, Nonce: nonce, Exporter: exporter}, answer, nil
+}
+
+// clientHandshake 客户端握手,legacy 为 true 时发送 V1 签名
+// V2 hello 不携带 V1 签名,旧版本服务端拒绝时返回 errLegacyServer
+func (server *ctrlNode) clientHandshake(conn quic.Connection, app *silly_ctrl.App, legacy bool) error {
+	stream, err := conn.OpenStream()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+	if err = stream.SetReadDeadline(time.Now().Add(time.Second * server.cfg.HandshakeTimeout)); err != nil {
+		return err
+	}
+	reader := packet.NewProtoReader(stream)
+	if legacy {
+		hello := app.Signature()
+		hello.Version = silly_ctrl.HandshakeV1
+		if _, err = protodelim.MarshalTo(stream, hello); err != nil {
+			return err
+		}
+		return readHandshakeRet(reader)
+	}
+	hello := &packet.Handshake{AccessKey: app.AccessKey, Version: silly_ctrl.HandshakeV2}
+	if app.Secret == "" {
+		hello.Version = silly_ctrl.HandshakeCert
+	}
+	if _, err = protodelim.MarshalTo(stream, hello); err != nil {
+		return err
+	}
+	challenge := &packet.Challenge{}
+	if err = protodelim.UnmarshalFrom(reader, challenge); err != nil {
+		if hello.Version == silly_ctrl.HandshakeV2 && isLegacyReject(err) {
+			return errLegacyServer
+		}
+		return err
+	}
+	if challenge.ErrNo != silly_ctrl.NoError.Code() {
+		return silly_ctrl.ErrorNo(challenge.ErrNo)
+	}
+	if hello.Version == silly_ctrl.HandshakeCert {
+		if challenge.Version != silly_ctrl.HandshakeCert {
+			server.logger.Warn("remote node does not support certificate handshake", "addr", conn.RemoteAddr())
+			return silly_ctrl.HandshakeFailedError
+		}
+		return readHandshakeRet(reader)
+	}
+	if challenge.Version < silly_ctrl.HandshakeV2 {
+		return silly_ctrl.HandshakeFailedError
+	}
+	exporter, err := exportKeyingMaterial(conn)
+	if err != nil {
+		return err
+	}
+	if _, err = protodelim.MarshalTo(stream, app.Answer(challenge.Nonce, exporter)); err != nil {
+		return err
+	}
+	return readHandshakeRet(reader)
+}
+
+// isLegacyReject 旧版本服务端按 V1 校验不带签名的 hello,以 SignatureTimeoutError 文本关闭连接,新版本不会对 V2 hello 返回该错误
+func isLegacyReject(err error) bool {
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && appErr.Remote && appErr.ErrorMessage == silly_ctrl.SignatureTimeoutError.String()
+}
+
+func readHandshakeRet(reader protodelim.Reader) error {
+	ret := &packet.Ret{}
+	if err := protodelim.UnmarshalFrom(reader, ret); err != nil {
+		return err
+	}
+	if ret.ErrNo != silly_ctrl.NoError.Code() {
+		return silly_ctrl.ErrorNo(ret.ErrNo)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplayCache(t *testing.T) {
+	cache := newReplayCache()
+	if !cache.Add("a", time.Hour) {
+		t.Fatal("first Add(a) = false")
+	}
+	if cache.Add("a", time.Hour) {
+		t.Fatal("second Add(a) = true, want replay rejected")
+	}
+	if !cache.Add("b", time.Millisecond) || !cache.Add("c", time.Millisecond*2) {
+		t.Fatal("Add(b, c) = false")
+	}
+	time.Sleep(time.Millisecond * 5)
+	// 过期项在下一次 Add 时按过期时间顺序移除,未过期项保留
+	if !cache.Add("b", time.Hour) {
+		t.Fatal("Add(b) after expiry = false")
+	}
+	if cache.Add("a", time.Hour) {
+		t.Fatal("Add(a) before expiry = true")
+	}
+	if _, ok := cache.seen["c"]; ok || len(cache.queue) != len(cache.seen) {
+		t.Fatalf("expired entries kept: seen %d, queue %d", len(cache.seen), len(cache.queue))
+	}
+}
+
+func TestReplayCacheLimit(t *testing.T) {
+	cache := newReplayCache()
+	for i := len(cache.seen); i < maxReplay; i++ {
+		if !cache.Add(strconv.Itoa(i), time.Hour) {
+			t.Fatalf("Add(%d) = false", i)
+		}
+	}
+	if cache.Add("full", time.Hour) {
+		t.Fatal("Add() on full cache = true")
+	}
+}
+
+func TestIsLegacyReject(t *testing.T) {
+	legacyMsg := silly_ctrl.SignatureTimeoutError.String()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"legacy server", &quic.ApplicationError{Remote: true, ErrorCode: quic.ApplicationErrorCode(silly_ctrl.UnknownError), ErrorMessage: legacyMsg}, true},
+		{"local close", &quic.ApplicationError{Remote: false, ErrorMessage: legacyMsg}, false},
+		{"other error", &quic.ApplicationError{Remote: true, ErrorMessage: silly_ctrl.HandshakeFailedError.String()}, false},
+		{"eof", io.EOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLegacyReject(tt.err); got != tt.want {
+				t.Fatalf("isLegacyReject(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// handshakePair 在回环地址上建立 QUIC 连接,服务端执行 serve,客户端执行 dial
+func handshakePair(t *testing.T, serve func(ctx context.Context, conn quic.Connection) error, dial func(conn quic.Connection) error) (serverErr, clientErr error) {
+	t.Helper()
+	cert, key, err := silly_ctrl.CreateCertificate(&silly_ctrl.CertRequest{CommonName: "localhost", Hosts: []string{"127.0.0.1"}, Server: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}}
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept(ctx)
+		if err != nil {
+			done <- err
+			return
+		}
+		if err = serve(ctx, conn); err != nil {
+			// 与 ctrlNode.start 相同,握手失败时以错误码关闭连接
+			ret := silly_ctrl.RetWithError(err)
+			_ = conn.CloseWithError(quic.ApplicationErrorCode(ret.ErrNo), ret.Msg)
+		}
+		done <- err
+	}()
+	conn, err := quic.DialAddr(ctx, listener.Addr().String(), &tls.Config{InsecureSkipVerify: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.CloseWithError(0, "")
+	}()
+	clientErr = dial(conn)
+	return <-done, clientErr
+}
+
+func testNode(legacy bool, apps ...silly_ctrl.App) *ctrlNode {
+	cfg := silly_ctrl.DefaultConfig()
+	cfg.LegacyHandshake = legacy
+	return &ctrlNode{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg:    cfg,
+		valid:  silly_ctrl.NewBasicValidator(apps),
+		replay: newReplayCache(),
+	}
+}
+
+func (server *ctrlNode) serveHandshake(ctx context.Context, conn quic.Connection) error {
+	_, _, err := server.handshake(ctx, conn)
+	return err
+}
+
+// readHello 读取客户端发送的首个 hello
+func readHello(ctx context.Context, conn quic.Connection) (*packet.Handshake, error) {
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hello := &packet.Handshake{}
+	return hello, protodelim.UnmarshalFrom(packet.NewProtoReader(stream), hello)
+}
+
+// sendHello 发送给定的握手内容并读取结果,用于模拟旧版本客户端与重放
+func sendHello(conn quic.Connection, hello *packet.Handshake) error {
+	stream, err := conn.OpenStream()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+	if _, err = protodelim.MarshalTo(stream, hello); err != nil {
+		return err
+	}
+	return readHandshakeRet(packet.NewProtoReader(stream))
+}
+
+func TestHandshake(t *testing.T) {
+	app := silly_ctrl.App{AccessKey: "agent", Secret: "secret"}
+	wrong := silly_ctrl.App{AccessKey: "agent", Secret: "wrong"}
+	unknown := silly_ctrl.App{AccessKey: "unknown", Secret: "secret"}
+	tests := []struct {
+		name   string
+		legacy bool // 服务端是否接受 V1 签名
+		client silly_ctrl.App
+		v1     bool // 客户端是否以 V1 签名握手
+		ok     bool
+	}{
+		{"v2", false, app, false, true},
+		{"v2 wrong secret", false, wrong, false, false},
+		{"v2 unknown app", false, unknown, false, false},
+		{"v1 accepted", true, app, true, true},
+		{"v1 disabled", false, app, true, false},
+		{"v1 wrong secret", true, wrong, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := testNode(tt.legacy, app), testNode(true)
+			serverErr, clientErr := handshakePair(t, server.serveHandshake, func(conn quic.Connection) error {
+				return client.clientHandshake(conn, &tt.client, tt.v1)
+			})
+			if tt.ok != (serverErr == nil) || tt.ok != (clientErr == nil) {
+				t.Fatalf("handshake server %v, client %v, want ok %v", serverErr, clientErr, tt.ok)
+			}
+		})
+	}
+}
+
+func TestClientHelloOmitsSignature(t *testing.T) {
+	app := silly_ctrl.App{AccessKey: "agent", Secret: "secret"}
+	client := testNode(true)
+	var hello *packet.Handshake
+	_, _ = handshakePair(t, func(ctx context.Context, conn quic.Connection) error {
+		var err error
+		hello, err = readHello(ctx, conn)
+		if err == nil {
+			err = silly_ctrl.HandshakeFailedError
+		}
+		return err
+	}, func(conn quic.Connection) error {
+		return client.clientHandshake(conn, &app, false)
+	})
+	if hello == nil || hello.Version != silly_ctrl.HandshakeV2 || hello.Sign != "" || hello.T != 0 {
+		t.Fatalf("V2 hello = %v, want no V1 signature", hello)
+	}
+}
+
+func TestHandshakeLegacyReplay(t *testing.T) {
+	app := silly_ctrl.App{AccessKey: "agent", Secret: "secret"}
+	server := testNode(true, app)
+	hello := app.Signature()
+	hello.Version = silly_ctrl.HandshakeV1
+	replay := func(conn quic.Connection) error {
+		return sendHello(conn, hello)
+	}
+	if serverErr, clientErr := handshakePair(t, server.serveHandshake, replay); serverErr != nil || clientErr != nil {
+		t.Fatalf("first handshake server %v, client %v", serverErr, clientErr)
+	}
+	if serverErr, _ := handshakePair(t, server.serveHandshake, replay); !errors.Is(serverErr, silly_ctrl.HandshakeFailedError) {
+		t.Fatalf("replayed handshake = %v, want %v", serverErr, silly_ctrl.HandshakeFailedError)
+	}
+}
+
+func TestHandshakeLegacyReplayAfterValidate(t *testing.T) {
+	app := silly_ctrl.App{AccessKey: "agent", Secret: "secret"}
+	server := testNode(true, app)
+	forged := (&silly_ctrl.App{AccessKey: "agent", Secret: "wrong"}).Signature()
+	forged.Version = silly_ctrl.HandshakeV1
+	_, _ = handshakePair(t, server.serveHandshake, func(conn quic.Connection) error {
+		return sendHello(conn, forged)
+	})
+	// 签名错误的握手不应占用重放缓存
+	if n := len(server.replay.seen); n != 0 {
+		t.Fatalf("replay cache has %d entries after failed handshake, want 0", n)
+	}
+}
+
+func TestClientHandshakeLegacyServer(t *testing.T) {
+	app := silly_ctrl.App{AccessKey: "agent", Secret: "secret"}
+	client := testNode(true)
+	// 旧版本服务端不区分版本,按 V1 校验 hello 中的签名
+	legacyServe := func(ctx context.Context, conn quic.Connection) error {
+		hello, err := readHello(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return app.Validate(hello)
+	}
+	serverErr, clientErr := handshakePair(t, legacyServe, func(conn quic.Connection) error {
+		return client.clientHandshake(conn, &app, false)
+	})
+	if !errors.Is(serverErr, silly_ctrl.SignatureTimeoutError) || !errors.Is(clientErr, errLegacyServer) {
+		t.Fatalf("handshake server %v, client %v, want %v", serverErr, clientErr, errLegacyServer)
+	}
+}
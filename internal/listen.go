@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// listenService 在本端监听,每个连接通过 PROXY 命令回连命令发起方
+// 发起方关闭命令 stream 时停止监听
+type listenService struct {
+}
+
+func (listenService) Type() packet.CommandType {
+	return packet.CommandType_LISTEN
+}
+
+func (service listenService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+	if len(command.Args) < 2 {
+		return silly_ctrl.BadParamError
+	}
+	network, address := command.Args[0], command.Args[1]
+	target, ok := command.GetParam("target")
+	if !ok || target == "" {
+		return silly_ctrl.BadParamError
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var closer io.Closer
+	var serve func()
+	lc := sess.App().Policy.ListenConfig(address)
+	if silly_ctrl.IsPacketNetwork(network) {
+		conn, err := lc.ListenPacket(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		closer = conn
+		serve = func() {
+			service.servePacket(ctx, sess, conn, network, target, packetIdleTimeout(command))
+		}
+	} else {
+		listener, err := lc.Listen(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		closer = listener
+		serve = func() {
+			service.serveStream(ctx, sess, listener, network, target)
+		}
+	}
+	if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		_ = closer.Close()
+		return err
+	}
+	logger := sessionLogger(sess)
+	logger.Info("reverse listen", "network", network, "address", address, "target", target, "session", sess.ID())
+	go func() {
+		_, _ = io.Copy(io.Discard, stream)
+		cancel()
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = closer.Close()
+	}()
+	serve()
+	logger.Info("reverse listen closed", "network", network, "address", address, "session", sess.ID())
+	return nil
+}
+
+func (service listenService) serveStream(ctx context.Context, sess silly_ctrl.Session, listener net.Listener, network, target string) {
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				_ = conn.Close()
+			}()
+			err := sess.Exec(ctx, packet.ProxyCommand(network, target), func(ctx context.Context, _ *packet.Ret, _ silly_ctrl.Session, stream quic.Stream) error {
+				return silly_ctrl.Forward(ctx, sess.App().AccessKey, conn, stream)
+			})
+			if err != nil {
+				sessionLogger(sess).Debug("reverse connection closed", "remote", conn.RemoteAddr(), "target", target, "err", err)
+			}
+		}()
+	}
+}
+
+// servePacket 按来源地址区分数据报流,每个流使用独立的 PROXY 命令回连,优先通过 datagram 转发
+func (service listenService) servePacket(ctx context.Context, sess silly_ctrl.Session, conn net.PacketConn, network, target string, idle time.Duration) {
+	_ = silly_ctrl.ServePacketConn(ctx, conn, func(ctx context.Context, pipe silly_ctrl.PacketPipe, addr net.Addr) {
+		err := silly_ctrl.PacketTunnel(ctx, sess, packet.ProxyCommand(network, target).SetParam("idle", idle.String()), func(ctx context.Context, tunnel silly_ctrl.PacketPipe) error {
+			return silly_ctrl.RelayPackets(ctx, sess.App().AccessKey, pipe, tunnel, idle)
+		})
+		if err != nil {
+			sessionLogger(sess).Debug("reverse packet flow closed", "remote", addr, "target", target, "err", err)
+		}
+	})
+}
@@ -7,34 +7,152 @@ import (
 
 type sessionManager struct {
 	rw      sync.RWMutex
+	cfg     *silly_ctrl.Config
 	mapping map[string]silly_ctrl.Session
+	apps    map[string][]silly_ctrl.Session // 按连接先后排列
+	cursor  map[string]int                  // round-robin 游标
+	nodeID  string
+	routes  *routeTable
 }
 
-func NewManager() silly_ctrl.SessionManager {
-	return &sessionManager{mapping: make(map[string]silly_ctrl.Session)}
+func NewManager(cfg *silly_ctrl.Config) silly_ctrl.SessionManager {
+	nodeID := cfg.NodeID
+	if nodeID == "" {
+		nodeID = newSessionID()
+	}
+	return &sessionManager{
+		nodeID:  nodeID,
+		routes:  newRouteTable(),
+		cfg:     cfg,
+		mapping: make(map[string]silly_ctrl.Session),
+		apps:    make(map[string][]silly_ctrl.Session),
+		cursor:  make(map[string]int),
+	}
 }
 
 func (manager *sessionManager) Put(sess silly_ctrl.Session) error {
+	evicted, err := manager.put(sess)
+	for _, s := range evicted {
+		_ = s.Close(silly_ctrl.SessionReplaced)
+	}
+	return err
+}
+
+func (manager *sessionManager) put(sess silly_ctrl.Session) ([]silly_ctrl.Session, error) {
 	manager.rw.Lock()
 	defer manager.rw.Unlock()
-	_, ok := manager.mapping[sess.ID()]
-	if ok {
-		return silly_ctrl.SessionAlreadyExists
+	if _, ok := manager.mapping[sess.ID()]; ok {
+		return nil, silly_ctrl.SessionAlreadyExists
+	}
+	var evicted []silly_ctrl.Session
+	ak := sess.App().AccessKey
+	if limit := manager.cfg.MaxSessionsPerApp; limit > 0 && !sess.IsRemote() {
+		var inbound []silly_ctrl.Session
+		for _, s := range manager.apps[ak] {
+			if !s.IsRemote() {
+				inbound = append(inbound, s)
+			}
+		}
+		if len(inbound) >= limit {
+			if !manager.cfg.ReplaceSession {
+				return nil, silly_ctrl.SessionAlreadyExists
+			}
+			evicted = inbound[:len(inbound)-limit+1]
+			for _, s := range evicted {
+				manager.del(s.ID())
+			}
+		}
 	}
 	manager.mapping[sess.ID()] = sess
-	return nil
+	manager.apps[ak] = append(manager.apps[ak], sess)
+	return evicted, nil
+}
+
+func (manager *sessionManager) Get(id string) (silly_ctrl.Session, bool) {
+	return manager.Select(id, "")
 }
 
-func (manager *sessionManager) Get(accessKey string) (silly_ctrl.Session, bool) {
+func (manager *sessionManager) Select(id string, policy silly_ctrl.SelectPolicy) (silly_ctrl.Session, bool) {
+	if policy == "" {
+		policy = manager.cfg.SelectPolicy
+	}
+	manager.rw.Lock()
+	defer manager.rw.Unlock()
+	if sess, ok := manager.mapping[id]; ok {
+		return sess, ok
+	}
+	sessions := manager.apps[id]
+	if len(sessions) < 1 {
+		return nil, false
+	}
+	switch policy {
+	case silly_ctrl.SelectLeastLoaded:
+		selected := sessions[0]
+		for _, sess := range sessions[1:] {
+			if sess.Streams() < selected.Streams() {
+				selected = sess
+			}
+		}
+		return selected, true
+	case silly_ctrl.SelectRoundRobin:
+		idx := manager.cursor[id] % len(sessions)
+		manager.cursor[id] = idx + 1
+		return sessions[idx], true
+	default:
+		return sessions[len(sessions)-1], true
+	}
+}
+
+func (manager *sessionManager) List() []silly_ctrl.Session {
+	manager.rw.RLock()
+	defer manager.rw.RUnlock()
+	ret := make([]silly_ctrl.Session, 0, len(manager.mapping))
+	for _, sessions := range manager.apps {
+		ret = append(ret, sessions...)
+	}
+	return ret
+}
+
+func (manager *sessionManager) GetByApp(accessKey string) []silly_ctrl.Session {
 	manager.rw.RLock()
 	defer manager.rw.RUnlock()
-	sess, ok := manager.mapping[accessKey]
-	return sess, ok
+	return append([]silly_ctrl.Session(nil), manager.apps[accessKey]...)
 }
 
-func (manager *sessionManager) Del(accessKey string) error {
+func (manager *sessionManager) Del(id string) error {
 	manager.rw.Lock()
 	defer manager.rw.Unlock()
-	delete(manager.mapping, accessKey)
+	manager.del(id)
 	return nil
 }
+
+func (manager *sessionManager) del(id string) {
+	sess, ok := manager.mapping[id]
+	if !ok {
+		return
+	}
+	delete(manager.mapping, id)
+	manager.routes.Remove(id)
+	ak := sess.App().AccessKey
+	sessions := manager.apps[ak]
+	for i, s := range sessions {
+		if s.ID() == id {
+			sessions = append(sessions[:i:i], sessions[i+1:]...)
+			break
+		}
+	}
+	if len(sessions) > 0 {
+		manager.apps[ak] = sessions
+	} else {
+		delete(manager.apps, ak)
+		delete(manager.cursor, ak)
+	}
+}
+
+func (manager *sessionManager) NodeID() string {
+	return manager.nodeID
+}
+
+func (manager *sessionManager) Routes() silly_ctrl.RouteTable {
+	return manager.routes
+}
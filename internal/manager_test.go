@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"errors"
+	"github.com/irealing/silly-ctrl"
+	"testing"
+)
+
+// fakeSession 仅实现 sessionManager 用到的方法
+type fakeSession struct {
+	silly_ctrl.Session
+	id      string
+	app     *silly_ctrl.App
+	remote  bool
+	streams int
+	closed  silly_ctrl.ErrorNo
+}
+
+func (sess *fakeSession) ID() string {
+	return sess.id
+}
+
+func (sess *fakeSession) App() *silly_ctrl.App {
+	return sess.app
+}
+
+func (sess *fakeSession) IsRemote() bool {
+	return sess.remote
+}
+
+func (sess *fakeSession) Streams() int {
+	return sess.streams
+}
+
+func (sess *fakeSession) Close(reason silly_ctrl.ErrorNo) error {
+	sess.closed = reason
+	return nil
+}
+
+func newFakeSessions(ak string, streams ...int) []*fakeSession {
+	app := &silly_ctrl.App{AccessKey: ak}
+	sessions := make([]*fakeSession, 0, len(streams))
+	for i, n := range streams {
+		sessions = append(sessions, &fakeSession{id: ak + "-" + string(rune('a'+i)), app: app, streams: n})
+	}
+	return sessions
+}
+
+func TestManagerSelect(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy silly_ctrl.SelectPolicy
+		want   []string // 连续调用 Select 的结果
+	}{
+		{"newest", silly_ctrl.SelectNewest, []string{"agent-c", "agent-c"}},
+		{"default", "", []string{"agent-c"}},
+		{"least loaded", silly_ctrl.SelectLeastLoaded, []string{"agent-b", "agent-b"}},
+		{"round robin", silly_ctrl.SelectRoundRobin, []string{"agent-a", "agent-b", "agent-c", "agent-a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(silly_ctrl.DefaultConfig())
+			for _, sess := range newFakeSessions("agent", 3, 1, 2) {
+				if err := manager.Put(sess); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, want := range tt.want {
+				if sess, ok := manager.Select("agent", tt.policy); !ok || sess.ID() != want {
+					t.Fatalf("Select() #%d = %v, want %s", i, sess, want)
+				}
+			}
+			// 会话 ID 优先于 AccessKey
+			if sess, ok := manager.Select("agent-a", tt.policy); !ok || sess.ID() != "agent-a" {
+				t.Fatalf("Select(agent-a) = %v", sess)
+			}
+			if _, ok := manager.Select("unknown", tt.policy); ok {
+				t.Fatal("Select(unknown) found a session")
+			}
+		})
+	}
+}
+
+func TestManagerLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace bool
+		remote  bool // 新会话是否为本端发起的连接,不受数量限制
+		err     error
+		evicted []string
+		want    []string // Put 第三个会话后的会话
+	}{
+		{"reject", false, false, silly_ctrl.SessionAlreadyExists, nil, []string{"agent-a", "agent-b"}},
+		{"replace oldest", true, false, nil, []string{"agent-a"}, []string{"agent-b", "agent-c"}},
+		{"remote not limited", false, true, nil, nil, []string{"agent-a", "agent-b", "agent-c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := silly_ctrl.DefaultConfig()
+			cfg.MaxSessionsPerApp, cfg.ReplaceSession = 2, tt.replace
+			manager := NewManager(cfg)
+			sessions := newFakeSessions("agent", 0, 0, 0)
+			sessions[2].remote = tt.remote
+			for _, sess := range sessions[:2] {
+				if err := manager.Put(sess); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := manager.Put(sessions[2]); !errors.Is(err, tt.err) {
+				t.Fatalf("Put() = %v, want %v", err, tt.err)
+			}
+			var evicted []string
+			for _, sess := range sessions {
+				if sess.closed == silly_ctrl.SessionReplaced {
+					evicted = append(evicted, sess.id)
+				}
+			}
+			if !equalStrings(evicted, tt.evicted) {
+				t.Fatalf("evicted %v, want %v", evicted, tt.evicted)
+			}
+			var got []string
+			for _, sess := range manager.GetByApp("agent") {
+				got = append(got, sess.ID())
+			}
+			if !equalStrings(got, tt.want) {
+				t.Fatalf("sessions %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerDel(t *testing.T) {
+	manager := NewManager(silly_ctrl.DefaultConfig())
+	sessions := newFakeSessions("agent", 0, 0)
+	for _, sess := range sessions {
+		if err := manager.Put(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manager.Put(sessions[0]); !errors.Is(err, silly_ctrl.SessionAlreadyExists) {
+		t.Fatalf("Put(duplicate) = %v, want %v", err, silly_ctrl.SessionAlreadyExists)
+	}
+	_ = manager.Del("agent-b")
+	if sess, ok := manager.Select("agent", silly_ctrl.SelectNewest); !ok || sess.ID() != "agent-a" {
+		t.Fatalf("Select() after Del = %v, want agent-a", sess)
+	}
+	_ = manager.Del("agent-a")
+	if _, ok := manager.Select("agent", ""); ok || len(manager.List()) != 0 {
+		t.Fatalf("sessions left after Del: %d", len(manager.List()))
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"sync/atomic"
+)
+
+// connStats 由 quic tracer 更新的连接统计
+type connStats struct {
+	rtt  atomic.Int64
+	lost atomic.Uint64
+}
+
+// trace 为每个连接创建 tracer,按 ConnectionTracingID 关联至会话
+func (server *ctrlNode) trace(ctx context.Context, _ logging.Perspective, _ quic.ConnectionID) *logging.ConnectionTracer {
+	id, ok := ctx.Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	if !ok {
+		return nil
+	}
+	stats := &connStats{}
+	server.conns.Store(id, stats)
+	return &logging.ConnectionTracer{
+		UpdatedMetrics: func(rttStats *logging.RTTStats, _, _ logging.ByteCount, _ int) {
+			stats.rtt.Store(int64(rttStats.SmoothedRTT()))
+		},
+		LostPacket: func(logging.EncryptionLevel, logging.PacketNumber, logging.PacketLossReason) {
+			stats.lost.Add(1)
+		},
+		Close: func() {
+			server.conns.Delete(id)
+		},
+	}
+}
+
+func (server *ctrlNode) connStats(conn quic.Connection) *connStats {
+	if id, ok := conn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID); ok {
+		if stats, ok := server.conns.Load(id); ok {
+			return stats.(*connStats)
+		}
+	}
+	return &connStats{}
+}
+
+// observeHandshake 按方向与 ErrorNo 统计握手结果
+func observeHandshake(direction string, err error) {
+	silly_ctrl.DefaultMetrics.Handshakes.Add(1, direction, silly_ctrl.ErrorLabel(err))
+}
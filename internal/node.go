@@ -3,10 +3,9 @@ package internal
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"github.com/irealing/silly-ctrl"
-	"github.com/irealing/silly-ctrl/packet"
 	"github.com/quic-go/quic-go"
-	"google.golang.org/protobuf/encoding/protodelim"
 	"log/slog"
 	"net"
 	"sync"
@@ -18,12 +17,14 @@ type ctrlNode struct {
 	tr             *quic.Transport
 	manager        silly_ctrl.SessionManager
 	valid          silly_ctrl.Validator
-	serviceMapping silly_ctrl.ServiceMapping
+	serviceMapping *silly_ctrl.ServiceMapping
 	quicConfig     quic.Config
 	cfg            *silly_ctrl.Config
+	replay         *replayCache
+	conns          sync.Map // quic.ConnectionTracingID -> *connStats
 }
 
-func CreateNode(logger *slog.Logger, cfg *silly_ctrl.Config, valid silly_ctrl.Validator, services silly_ctrl.ServiceMapping) (silly_ctrl.Node, error) {
+func CreateNode(logger *slog.Logger, cfg *silly_ctrl.Config, valid silly_ctrl.Validator, services *silly_ctrl.ServiceMapping) (silly_ctrl.Node, error) {
 	if cfg == nil {
 		cfg = silly_ctrl.DefaultConfig()
 	}
@@ -35,18 +36,22 @@ func CreateNode(logger *slog.Logger, cfg *silly_ctrl.Config, valid silly_ctrl.Va
 	if err != nil {
 		return nil, err
 	}
-	return &ctrlNode{
+	node := &ctrlNode{
 		logger:  logger,
 		tr:      &quic.Transport{Conn: conn},
-		manager: NewManager(),
+		manager: NewManager(cfg),
 		valid:   valid,
 		cfg:     cfg,
 		quicConfig: quic.Config{
 			KeepAlivePeriod: time.Second * cfg.MaxHeartbeatInterval,
 			MaxIdleTimeout:  time.Second * cfg.MaxHeartbeatInterval * 2,
+			EnableDatagrams: true,
 		},
 		serviceMapping: services,
-	}, nil
+		replay:         newReplayCache(),
+	}
+	node.quicConfig.Tracer = node.trace
+	return node, nil
 }
 
 func (server *ctrlNode) Run(ctx context.Context, tlsConfig *tls.Config) error {
@@ -87,7 +92,8 @@ func (server *ctrlNode) start(ctx context.Context, connections <-chan quic.Conne
 			sess, err := server.createSession(ctx, conn)
 			if err != nil {
 				server.logger.Error("create session error ", "remote", conn.RemoteAddr(), "err", err)
-				if err = conn.CloseWithError(quic.ApplicationErrorCode(silly_ctrl.UnknownError.Code()), err.Error()); err != nil {
+				ret := silly_ctrl.RetWithError(err)
+				if err = conn.CloseWithError(quic.ApplicationErrorCode(ret.ErrNo), ret.Msg); err != nil {
 					server.logger.Error("close connection error", "remote", conn.RemoteAddr(), "err", err)
 				}
 				continue
@@ -111,87 +117,53 @@ func (server *ctrlNode) runSession(ctx context.Context, sess *session, wg *sync.
 }
 func (server *ctrlNode) createSession(ctx context.Context, conn quic.Connection) (*session, error) {
 	app, _, err := server.handshake(ctx, conn)
+	observeHandshake("in", err)
 	if err != nil {
 		return nil, err
 	}
-	server.logger.Info("handshake success", "app", app.AccessKey, "addr", conn.RemoteAddr())
-	if _, ok := server.manager.Get(app.AccessKey); ok {
-		return nil, silly_ctrl.SessionAlreadyExists
-	}
 	sess := &session{
+		id:            newSessionID(),
+		connectedAt:   time.Now(),
 		app:           app,
 		logger:        server.logger,
 		conn:          conn,
 		isRemote:      false,
+		conns:         server.connStats(conn),
 		cfg:           server.cfg,
 		handleMapping: server.serviceMapping,
 		manager:       server.manager,
 	}
+	server.logger.Info("handshake success", "app", app.AccessKey, "addr", conn.RemoteAddr(), "session", sess.id)
 	return sess, server.manager.Put(sess)
 }
-func (server *ctrlNode) handshake(ctx context.Context, conn quic.Connection) (*silly_ctrl.App, *packet.Handshake, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	authStream, err := conn.AcceptStream(ctx)
-	if err != nil {
-		return nil, nil, err
-	}
-	go func() {
-		<-ctx.Done()
-		authStream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
-		if err := authStream.Close(); err != nil {
-			server.logger.Error("close auth stream error", "err", err)
-		}
-	}()
-	if err = authStream.SetReadDeadline(time.Now().Add(time.Second * server.cfg.HandshakeTimeout)); err != nil {
-		return nil, nil, silly_ctrl.AuthError
-	}
-	hs := &packet.Handshake{}
-	if err = protodelim.UnmarshalFrom(packet.NewProtoReader(authStream), hs); err != nil {
-		return nil, nil, err
-	}
-	app, err := server.valid.Validate(hs)
-	if err != nil {
-		return nil, nil, err
-	}
-	_, err = protodelim.MarshalTo(authStream, &packet.Ret{
-		ErrNo: silly_ctrl.NoError.Code(),
-		Msg:   silly_ctrl.NoError.String(),
-	})
-
-	if err != nil {
-		server.logger.Warn("write handshake ret failed", "err", err)
-	}
-	return app, hs, err
-}
 func (server *ctrlNode) Connect(ctx context.Context, addr string, app *silly_ctrl.App, config *tls.Config) error {
+	return server.ConnectNotify(ctx, addr, app, config, nil)
+}
+
+func (server *ctrlNode) ConnectNotify(ctx context.Context, addr string, app *silly_ctrl.App, config *tls.Config, connected func(silly_ctrl.Session)) error {
 	remoteAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return err
 	}
-	conn, err := server.tr.Dial(ctx, remoteAddr, config, &server.quicConfig)
+	conn, err := server.dial(ctx, remoteAddr, app, config, false)
+	if errors.Is(err, errLegacyServer) && server.cfg.LegacyHandshake {
+		server.logger.Warn("remote node only supports legacy handshake", "addr", remoteAddr)
+		conn, err = server.dial(ctx, remoteAddr, app, config, true)
+	}
 	if err != nil {
 		return err
 	}
 	defer func() {
 		_ = conn.CloseWithError(quic.ApplicationErrorCode(silly_ctrl.ApplicationOver), silly_ctrl.ApplicationOver.Error())
 	}()
-	err = silly_ctrl.DoQUICRequest[*packet.Handshake, *packet.Ret](
-		ctx, app.Signature(), &packet.Ret{}, conn,
-		func(ctx context.Context, response *packet.Ret, stream quic.Stream) error {
-			if response.ErrNo != silly_ctrl.NoError.Code() {
-				return silly_ctrl.ErrorNo(response.ErrNo)
-			}
-			return err
-		})
-	if err != nil {
-		return err
-	}
 	sess := &session{
+		id:            newSessionID(),
+		connectedAt:   time.Now(),
 		app:           app,
 		logger:        server.logger,
 		conn:          conn,
 		isRemote:      true,
+		conns:         server.connStats(conn),
 		handleMapping: server.serviceMapping,
 		manager:       server.manager,
 		cfg:           server.cfg,
@@ -200,8 +172,29 @@ func (server *ctrlNode) Connect(ctx context.Context, addr string, app *silly_ctr
 	if err = server.manager.Put(sess); err != nil {
 		return err
 	}
+	if connected != nil {
+		connected(sess)
+	}
 	return sess.run(ctx)
 }
+
+// dial 建立连接并完成握手,失败时关闭连接
+func (server *ctrlNode) dial(ctx context.Context, addr *net.UDPAddr, app *silly_ctrl.App, config *tls.Config, legacy bool) (quic.Connection, error) {
+	conn, err := server.tr.Dial(ctx, addr, config, &server.quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	err = server.clientHandshake(conn, app, legacy)
+	if !errors.Is(err, errLegacyServer) {
+		observeHandshake("out", err)
+	}
+	if err != nil {
+		_ = conn.CloseWithError(quic.ApplicationErrorCode(silly_ctrl.ApplicationOver), silly_ctrl.ApplicationOver.Error())
+		return nil, err
+	}
+	return conn, nil
+}
+
 func (server *ctrlNode) Manager() silly_ctrl.SessionManager {
 	return server.manager
 }
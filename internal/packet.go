@@ -0,0 +1,16 @@
+package internal
+
+import (
+	"github.com/irealing/silly-ctrl/packet"
+	"time"
+)
+
+const defaultPacketIdle = time.Minute
+
+func packetIdleTimeout(command *packet.Command) time.Duration {
+	idle, err := time.ParseDuration(command.GetParamWithDefault("idle", ""))
+	if err != nil || idle <= 0 {
+		return defaultPacketIdle
+	}
+	return idle
+}
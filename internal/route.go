@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"sort"
+	"sync"
+	"time"
+)
+
+type routeTable struct {
+	rw     sync.RWMutex
+	routes map[string]map[string]silly_ctrl.Route // session -> AccessKey -> Route
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{routes: make(map[string]map[string]silly_ctrl.Route)}
+}
+
+func (table *routeTable) Update(session, node string, entries map[string]int, ttl time.Duration) {
+	routes := make(map[string]silly_ctrl.Route, len(entries))
+	expireAt := time.Now().Add(ttl)
+	for ak, hops := range entries {
+		routes[ak] = silly_ctrl.Route{AccessKey: ak, Session: session, Node: node, Hops: hops, ExpireAt: expireAt}
+	}
+	table.rw.Lock()
+	defer table.rw.Unlock()
+	table.routes[session] = routes
+}
+
+func (table *routeTable) Remove(session string) {
+	table.rw.Lock()
+	defer table.rw.Unlock()
+	delete(table.routes, session)
+}
+
+func (table *routeTable) Lookup(accessKey string) (silly_ctrl.Route, bool) {
+	table.rw.RLock()
+	defer table.rw.RUnlock()
+	now := time.Now()
+	var best silly_ctrl.Route
+	found := false
+	for _, routes := range table.routes {
+		route, ok := routes[accessKey]
+		if !ok || route.ExpireAt.Before(now) {
+			continue
+		}
+		if !found || route.Hops < best.Hops || (route.Hops == best.Hops && route.ExpireAt.After(best.ExpireAt)) {
+			best, found = route, true
+		}
+	}
+	return best, found
+}
+
+func (table *routeTable) Dump() []silly_ctrl.Route {
+	table.rw.RLock()
+	defer table.rw.RUnlock()
+	now := time.Now()
+	var routes []silly_ctrl.Route
+	for _, rs := range table.routes {
+		for _, route := range rs {
+			if route.ExpireAt.After(now) {
+				routes = append(routes, route)
+			}
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].AccessKey != routes[j].AccessKey {
+			return routes[i].AccessKey < routes[j].AccessKey
+		}
+		return routes[i].Hops < routes[j].Hops
+	})
+	return routes
+}
+
+// routeService 接收对端的路由通告,仅采纳会话 App 的 Policy.Routes 允许的 AccessKey,stream 结束时删除经该会话学习到的路由
+type routeService struct {
+}
+
+func (routeService) Type() packet.CommandType {
+	return packet.CommandType_ROUTE
+}
+
+func (routeService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, manager silly_ctrl.SessionManager, stream quic.Stream) error {
+	interval, err := time.ParseDuration(command.GetParamWithDefault("interval", ""))
+	if err != nil || interval <= 0 {
+		return silly_ctrl.BadParamError
+	}
+	if _, err = protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		return err
+	}
+	defer manager.Routes().Remove(sess.ID())
+	policy := sess.App().Policy
+	reader := packet.NewProtoReader(stream)
+	for {
+		var advert packet.RouteAdvert
+		if err = protodelim.UnmarshalFrom(reader, &advert); err != nil {
+			return nil
+		}
+		entries := make(map[string]int, len(advert.Entries))
+		for _, entry := range advert.Entries {
+			if !policy.AllowRoute(entry.AccessKey) {
+				continue
+			}
+			// 对端通告的是其自身的跳数,经本会话到达需再加一跳
+			if hops := int(entry.Hops) + 1; hops <= silly_ctrl.DefaultMaxHops {
+				entries[entry.AccessKey] = hops
+			}
+		}
+		// 连续错过三次通告后路由过期
+		manager.Routes().Update(sess.ID(), advert.Node, entries, interval*3)
+	}
+}
+
+// advertiseRoutes 周期性地向对端通告经本节点可达的 AccessKey
+// 直连的入站会话跳数为 1,不向下一跳会话回传经其学习到的路由
+// 仅向 App 配置了 Policy.Advertise 的会话通告,且只通告其允许的 AccessKey
+func (sess *session) advertiseRoutes(ctx context.Context) error {
+	interval := time.Second * sess.cfg.RouteAdvertInterval
+	if policy := sess.App().Policy; interval <= 0 || policy == nil || len(policy.Advertise) < 1 {
+		return nil
+	}
+	cmd := (&packet.Command{Type: packet.CommandType_ROUTE}).SetParam("interval", interval.String())
+	err := sess.Exec(ctx, cmd, func(ctx context.Context, _ *packet.Ret, _ silly_ctrl.Session, stream quic.Stream) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := protodelim.MarshalTo(stream, sess.routeAdvert()); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		sess.logger.Warn("advertise routes error", "session", sess.ID(), "err", err)
+	}
+	return nil
+}
+
+func (sess *session) routeAdvert() *packet.RouteAdvert {
+	hops := make(map[string]int)
+	for _, s := range sess.manager.List() {
+		if s.ID() != sess.ID() && !s.IsRemote() {
+			hops[s.App().AccessKey] = 1
+		}
+	}
+	for _, route := range sess.manager.Routes().Dump() {
+		if route.Session == sess.ID() || route.Hops >= silly_ctrl.DefaultMaxHops {
+			continue
+		}
+		if h, ok := hops[route.AccessKey]; !ok || route.Hops < h {
+			hops[route.AccessKey] = route.Hops
+		}
+	}
+	delete(hops, sess.App().AccessKey)
+	policy := sess.App().Policy
+	advert := &packet.RouteAdvert{Node: sess.manager.NodeID()}
+	for ak, h := range hops {
+		if !policy.AllowAdvert(ak) {
+			continue
+		}
+		advert.Entries = append(advert.Entries, &packet.RouteEntry{AccessKey: ak, Hops: uint32(h)})
+	}
+	return advert
+}
@@ -4,10 +4,16 @@ import (
 	"github.com/irealing/silly-ctrl"
 )
 
-func CreateServiceMapping() silly_ctrl.ServiceMapping {
-	ret := make(silly_ctrl.ServiceMapping)
-	return ret.Register(forwardService{}).
+func CreateServiceMapping() *silly_ctrl.ServiceMapping {
+	return silly_ctrl.NewServiceMapping().Register(forwardService{}).
 		Register(proxyService{}).
 		Register(execService{}).
+		Register(echoService{}).
+		Register(shellService{}).
+		Register(listenService{}).
+		Register(routeService{}).
+		Register(fileGetService{}).
+		Register(filePutService{}).
+		Register(fsService{}).
 		Register(emptyService{})
 }
@@ -2,15 +2,21 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/irealing/silly-ctrl"
 	"github.com/irealing/silly-ctrl/packet"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
 	"net"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 type forwardService struct {
@@ -20,35 +26,129 @@ func (forward forwardService) Type() packet.CommandType {
 	return packet.CommandType_FORWARD
 }
 
+// Invoke FORWARD <HOP> <ADDRESS> [route=<HOP,...>] [ttl=<N>] [path=<NODE,...>]
+// route 为空时由 HOP 对 ADDRESS 执行 PROXY,否则向 HOP 发送去掉首跳的 FORWARD
+// ttl 为剩余可用跳数,path 为已经过的节点标识,用于环路检测
 func (forward forwardService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, manager silly_ctrl.SessionManager, stream quic.Stream) error {
 	if len(command.Args) < 2 {
 		return silly_ctrl.BadParamError
 	}
 	remote, address := command.Args[0], command.Args[1]
-
-	dest, ok := manager.Get(remote)
+	hops := silly_ctrl.SplitList(command.GetParamWithDefault("route", ""))
+	ttl, path, err := forward.checkHops(command, manager, len(hops))
+	if err != nil {
+		return err
+	}
+	// 各跳已由 Policy.Check 按发起会话的 Forward 规则校验
+	for len(hops) > 0 && forward.isSelf(sess, remote) {
+		remote, hops = hops[0], hops[1:]
+	}
+	if len(hops) < 1 && forward.isSelf(sess, remote) {
+		newCmd := &packet.Command{
+			Type:   packet.CommandType_PROXY,
+			Args:   []string{address},
+			Params: command.Params,
+		}
+		if err = sess.App().Policy.Check(ctx, newCmd); err != nil {
+			return err
+		}
+		return proxyService{}.Invoke(ctx, newCmd, sess, manager, stream)
+	}
+	policy := silly_ctrl.SelectPolicy(command.GetParamWithDefault("select", ""))
+	dest, ok := manager.Select(remote, policy)
 	if !ok {
-		return silly_ctrl.UnknownSessionError
+		// 无直连会话时经路由表中的下一跳转发,由下一跳继续解析 remote
+		route, found := manager.Routes().Lookup(remote)
+		if !found {
+			return silly_ctrl.UnknownSessionError
+		}
+		if dest, ok = manager.Get(route.Session); !ok {
+			return silly_ctrl.UnknownSessionError
+		}
+		hops = append([]string{remote}, hops...)
+		if ttl <= len(hops) {
+			return fmt.Errorf("%w: ttl %d route %d", silly_ctrl.HopLimitError, ttl, len(hops))
+		}
 	}
 	newCmd := &packet.Command{
 		Type:   packet.CommandType_PROXY,
 		Args:   []string{address},
-		Params: command.Params,
+		Params: make([]*packet.CommandParam, 0, len(command.Params)),
 	}
-	if sess.ID() == remote {
-		return proxyService{}.Invoke(ctx, newCmd, sess, manager, stream)
+	for _, param := range command.Params {
+		switch param.Key {
+		case "flow", "route", "ttl", "path":
+		default:
+			newCmd.Params = append(newCmd.Params, param)
+		}
+	}
+	if len(hops) > 0 {
+		newCmd.Type = packet.CommandType_FORWARD
+		newCmd.Args = []string{hops[0], address}
+		if len(hops) > 1 {
+			newCmd.SetParam("route", strings.Join(hops[1:], ","))
+		}
+		newCmd.SetParam("ttl", strconv.Itoa(ttl-1))
+		newCmd.SetParam("path", strings.Join(append(path, manager.NodeID()), ","))
 	}
-	return dest.Exec(ctx, newCmd, func(ctx context.Context, _ *packet.Ret, sess silly_ctrl.Session, remoteStream quic.Stream) error {
+	if silly_ctrl.IsPacketNetwork(command.GetParamWithDefault("network", "tcp")) {
+		return forward.forwardPacket(ctx, command, newCmd, sess, dest, stream)
+	}
+	return dest.Exec(ctx, newCmd, func(ctx context.Context, _ *packet.Ret, _ silly_ctrl.Session, remoteStream quic.Stream) error {
 		if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
 			return err
 		}
-		if err := silly_ctrl.Forward(ctx, remoteStream, stream); err != nil {
+		if err := silly_ctrl.Forward(ctx, sess.App().AccessKey, remoteStream, stream); err != nil {
 			return err
 		}
 		return nil
 	})
 }
 
+func (forward forwardService) isSelf(sess silly_ctrl.Session, remote string) bool {
+	return sess.ID() == remote || (sess.IsRemote() && sess.App().AccessKey == remote)
+}
+
+// checkHops 校验剩余跳数与已经过的节点,返回当前 ttl 与 path
+func (forward forwardService) checkHops(command *packet.Command, manager silly_ctrl.SessionManager, hops int) (int, []string, error) {
+	ttl := silly_ctrl.DefaultMaxHops
+	if val, ok := command.GetParam("ttl"); ok {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, nil, silly_ctrl.BadParamError
+		}
+		ttl = n
+	}
+	if ttl <= hops {
+		return 0, nil, fmt.Errorf("%w: ttl %d route %d", silly_ctrl.HopLimitError, ttl, hops)
+	}
+	path := silly_ctrl.SplitList(command.GetParamWithDefault("path", ""))
+	for _, node := range path {
+		if node == manager.NodeID() {
+			return 0, nil, fmt.Errorf("%w: node %s", silly_ctrl.RouteLoopError, node)
+		}
+	}
+	return ttl, path, nil
+}
+
+// forwardPacket 转发数据报流,发起方与目标会话可分别使用 datagram 或 stream 帧
+func (forward forwardService) forwardPacket(ctx context.Context, command, newCmd *packet.Command, sess, dest silly_ctrl.Session, stream quic.Stream) error {
+	ctx, in, err := silly_ctrl.AcceptPacketPipe(ctx, sess, command, stream)
+	if err != nil {
+		return err
+	}
+	err = silly_ctrl.PacketTunnel(ctx, dest, newCmd, func(ctx context.Context, out silly_ctrl.PacketPipe) error {
+		if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+			return err
+		}
+		return silly_ctrl.RelayPackets(ctx, sess.App().AccessKey, in, out, packetIdleTimeout(command))
+	})
+	if err != nil {
+		_ = in.Close()
+	}
+	return err
+}
+
 type proxyService struct {
 }
 
@@ -56,16 +156,21 @@ func (proxy proxyService) Type() packet.CommandType {
 	return packet.CommandType_PROXY
 }
 
-func (proxy proxyService) Invoke(ctx context.Context, command *packet.Command, _ silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+func (proxy proxyService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
 	if len(command.Args) < 1 {
 		return silly_ctrl.BadParamError
 	}
 	address := command.Args[0]
 	network := command.GetParamWithDefault("network", "tcp")
-	conn, err := net.Dial(network, address)
-	if err != nil {
+	conn, err := sess.App().Policy.ProxyDialer(address).DialContext(ctx, network, address)
+	if errors.Is(err, silly_ctrl.PermissionDenied) {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("dial %s:%s", network, address)
 	}
+	if silly_ctrl.IsPacketNetwork(network) {
+		return proxy.relayPacket(ctx, command, sess, conn, stream)
+	}
 	_, err = protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError))
 	if err != nil {
 		return fmt.Errorf("write ret error %s", err)
@@ -77,15 +182,31 @@ func (proxy proxyService) Invoke(ctx context.Context, command *packet.Command, _
 		stream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
 		return stream.Close()
 	})
+	app := sess.App().AccessKey
 	eg.Go(func() error {
-		return silly_ctrl.CopyWithContext(ctx, stream, conn)
+		return silly_ctrl.CopyWithContext(ctx, stream, silly_ctrl.CountingWriter(conn, app, "stream"))
 	})
 	eg.Go(func() error {
-		return silly_ctrl.CopyWithContext(ctx, conn, stream)
+		return silly_ctrl.CopyWithContext(ctx, conn, silly_ctrl.CountingWriter(stream, app, "stream"))
 	})
 	return eg.Wait()
 }
 
+// relayPacket 命令携带 flow 参数时通过 datagram 转发,否则使用 stream 帧
+func (proxy proxyService) relayPacket(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, conn net.Conn, stream quic.Stream) error {
+	ctx, pipe, err := silly_ctrl.AcceptPacketPipe(ctx, sess, command, stream)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if _, err = protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		_ = conn.Close()
+		_ = pipe.Close()
+		return fmt.Errorf("write ret error %s", err)
+	}
+	return silly_ctrl.RelayPackets(ctx, sess.App().AccessKey, silly_ctrl.ConnPipe(conn), pipe, packetIdleTimeout(command))
+}
+
 type execService struct {
 }
 
@@ -93,19 +214,157 @@ func (execService) Type() packet.CommandType {
 	return packet.CommandType_EXEC
 }
 
-func (execService) Invoke(ctx context.Context, command *packet.Command, _ silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+func (service execService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
 	if len(command.Args) < 1 {
 		return silly_ctrl.BadParamError
 	}
-	if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+	dir, err := commandDir(command, sess)
+	if err != nil {
 		return err
 	}
 	cmd := exec.CommandContext(ctx, command.Args[0], command.Args[1:]...)
-	cmd.Path = command.GetParamWithDefault("dir", ".")
-	cmd.Env = strings.Split(command.GetParamWithDefault("env", ""), ";")
-	cmd.Stdout = stream
-	cmd.Stderr = stream
-	return cmd.Run()
+	cmd.Dir = dir
+	if env := silly_ctrl.CommandEnv(command); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	writer := silly_ctrl.NewFrameWriter(stream)
+	cmd.Stdout = writer.Writer(packet.FrameType_STDOUT)
+	cmd.Stderr = writer.Writer(packet.FrameType_STDERR)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	if _, err = protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	go service.input(stream, stdin, cmd)
+	err = cmd.Wait()
+	stream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
+	return writer.Close(&packet.Frame{Type: packet.FrameType_RESULT, Result: execResult(cmd, err, time.Since(start))})
+}
+
+// commandDir 按会话 App 的 Policy 解析 dir 参数,与策略校验的路径一致
+func commandDir(command *packet.Command, sess silly_ctrl.Session) (string, error) {
+	dir := command.GetParamWithDefault("dir", "")
+	if dir == "" {
+		return "", nil
+	}
+	return sess.App().Policy.ResolvePath(dir, true)
+}
+
+// input 处理客户端发送的 STDIN/SIGNAL 帧,读取结束或收到空的 STDIN 帧时关闭标准输入
+func (execService) input(stream quic.Stream, stdin io.WriteCloser, cmd *exec.Cmd) {
+	defer func() {
+		_ = stdin.Close()
+	}()
+	reader := packet.NewProtoReader(stream)
+	for {
+		frame := &packet.Frame{}
+		if err := protodelim.UnmarshalFrom(reader, frame); err != nil {
+			return
+		}
+		switch frame.Type {
+		case packet.FrameType_STDIN:
+			if len(frame.Data) < 1 {
+				_ = stdin.Close()
+				continue
+			}
+			if _, err := stdin.Write(frame.Data); err != nil {
+				return
+			}
+		case packet.FrameType_SIGNAL:
+			_ = cmd.Process.Signal(syscall.Signal(frame.Signal))
+		}
+	}
+}
+
+func execResult(cmd *exec.Cmd, err error, duration time.Duration) *packet.ExecResult {
+	ret := &packet.ExecResult{ExitCode: int32(exitCode(err)), Duration: int64(duration)}
+	if state := cmd.ProcessState; state != nil {
+		ret.ExitCode = int32(state.ExitCode())
+		ret.Signal = processSignal(state)
+		ret.UserTime = int64(state.UserTime())
+		ret.SystemTime = int64(state.SystemTime())
+		ret.MaxRss = maxRSS(state)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		ret.Error = err.Error()
+	}
+	return ret
+}
+
+type echoService struct {
+}
+
+func (echoService) Type() packet.CommandType {
+	return packet.CommandType_ECHO
+}
+
+func (echo echoService) Invoke(ctx context.Context, command *packet.Command, _ silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+	mode := command.GetParamWithDefault("mode", packet.EchoModeReflect)
+	if mode != packet.EchoModeReflect && mode != packet.EchoModePing && mode != packet.EchoModeBulk {
+		return silly_ctrl.BadParamError
+	}
+	if _, err := protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		return err
+	}
+	var err error
+	switch mode {
+	case packet.EchoModePing:
+		err = echo.ping(ctx, stream)
+	case packet.EchoModeBulk:
+		err = echo.bulk(ctx, stream)
+	default:
+		err = silly_ctrl.CopyWithContext(ctx, stream, stream)
+	}
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func (echoService) ping(ctx context.Context, stream quic.Stream) error {
+	reader := packet.NewProtoReader(stream)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		msg := &packet.EchoPing{}
+		if err := protodelim.UnmarshalFrom(reader, msg); err != nil {
+			return err
+		}
+		if _, err := protodelim.MarshalTo(stream, msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (echoService) bulk(ctx context.Context, stream quic.Stream) error {
+	counter := &countWriter{}
+	start := time.Now()
+	if err := silly_ctrl.CopyWithContext(ctx, stream, counter); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	_, err := protodelim.MarshalTo(stream, &packet.EchoStat{Bytes: counter.n, Duration: int64(time.Since(start))})
+	return err
+}
+
+type countWriter struct {
+	n uint64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += uint64(len(p))
+	return len(p), nil
 }
 
 type emptyService struct {
@@ -2,6 +2,9 @@ package internal
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"github.com/irealing/silly-ctrl"
 	packet2 "github.com/irealing/silly-ctrl/packet"
@@ -11,16 +14,29 @@ import (
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+func newSessionID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
 type session struct {
+	id            string
+	connectedAt   time.Time
+	streams       atomic.Int64
+	flows         flowTable
 	app           *silly_ctrl.App
 	logger        *slog.Logger
 	conn          quic.Connection
-	heartbeat     packet2.Heartbeat
+	heartbeat     atomic.Pointer[packet2.Heartbeat] // 对端最近一次心跳
+	heartbeatAt   atomic.Int64                      // 最近一次收到心跳的时间
+	conns         *connStats
 	isRemote      bool
-	handleMapping silly_ctrl.ServiceMapping
+	handleMapping *silly_ctrl.ServiceMapping
 	manager       silly_ctrl.SessionManager
 	cfg           *silly_ctrl.Config
 }
@@ -30,7 +46,42 @@ func (sess *session) IsRemote() bool {
 }
 
 func (sess *session) ID() string {
-	return sess.app.AccessKey
+	return sess.id
+}
+
+func (sess *session) ConnectedAt() time.Time {
+	return sess.connectedAt
+}
+
+func (sess *session) Streams() int {
+	return int(sess.streams.Load())
+}
+
+func (sess *session) Stats() silly_ctrl.SessionStats {
+	stats := silly_ctrl.SessionStats{
+		RTT:         time.Duration(sess.conns.rtt.Load()),
+		LostPackets: sess.conns.lost.Load(),
+	}
+	if at := sess.heartbeatAt.Load(); at > 0 {
+		stats.LastHeartbeat = time.Unix(0, at)
+	}
+	return stats
+}
+
+func (sess *session) ConnectionState() tls.ConnectionState {
+	return sess.conn.ConnectionState().TLS
+}
+
+// sessionLogger 服务使用调用方会话的 logger,即节点的 logger
+func sessionLogger(sess silly_ctrl.Session) *slog.Logger {
+	if s, ok := sess.(*session); ok {
+		return s.logger
+	}
+	return slog.Default()
+}
+
+func (sess *session) Close(reason silly_ctrl.ErrorNo) error {
+	return sess.conn.CloseWithError(quic.ApplicationErrorCode(reason.Code()), reason.Error())
 }
 
 func (sess *session) RemoteAddr() net.Addr {
@@ -42,7 +93,10 @@ func (sess *session) App() *silly_ctrl.App {
 }
 
 func (sess *session) Info() *packet2.Heartbeat {
-	return &sess.heartbeat
+	if beat := sess.heartbeat.Load(); beat != nil {
+		return beat
+	}
+	return &packet2.Heartbeat{}
 }
 
 func (sess *session) run(ctx context.Context) error {
@@ -56,6 +110,12 @@ func (sess *session) run(ctx context.Context) error {
 	eg.Go(func() error {
 		return sess.start(ctx)
 	})
+	eg.Go(func() error {
+		return sess.receiveDatagram(ctx)
+	})
+	eg.Go(func() error {
+		return sess.advertiseRoutes(ctx)
+	})
 	return eg.Wait()
 }
 func (sess *session) runHeartbeat(ctx context.Context) error {
@@ -118,11 +178,14 @@ func (sess *session) receiveHeartbeat(ctx context.Context) error {
 			sess.logger.Error("set read deadline error", "err", err)
 			return err
 		}
-		if err = protodelim.UnmarshalFrom(packet2.NewProtoReader(stream), &sess.heartbeat); err != nil {
+		beat := &packet2.Heartbeat{}
+		if err = protodelim.UnmarshalFrom(packet2.NewProtoReader(stream), beat); err != nil {
 			sess.logger.Error("receive heartbeat error", "err", err)
 			return err
 		} else {
-			sess.logger.Debug("receive heartbeat", "info", &sess.heartbeat)
+			sess.heartbeat.Store(beat)
+			sess.heartbeatAt.Store(time.Now().UnixNano())
+			sess.logger.Debug("receive heartbeat", "info", beat)
 		}
 		select {
 		case <-ctx.Done():
@@ -147,8 +210,10 @@ func (sess *session) start(ctx context.Context) error {
 				return err
 			}
 			wg.Add(1)
+			sess.streams.Add(1)
 			go func() {
 				defer wg.Done()
+				defer sess.streams.Add(-1)
 				if err := sess.handleCommand(ctx, cmd, stream); err != nil {
 					sess.logger.Warn("handle command error", "cmd", cmd, "err", err)
 				}
@@ -163,8 +228,8 @@ func (sess *session) handleCommand(ctx context.Context, cmd *packet2.Command, st
 			sess.logger.Error("close stream error", "err", err)
 		}
 	}()
-	sess.logger.Debug("receive command", "type", cmd.Type, "session", sess.app.AccessKey)
-	defer sess.logger.Debug("command invoke done", "type", cmd.Type, "session", sess.app.AccessKey, "err", err)
+	sess.logger.Debug("receive command", "type", cmd.Type, "session", sess.id, "app", sess.app.AccessKey)
+	defer sess.logger.Debug("command invoke done", "type", cmd.Type, "session", sess.id, "app", sess.app.AccessKey, "err", err)
 	err = sess.handleMapping.Invoke(ctx, cmd, sess, sess.manager, stream)
 	return err
 }
@@ -173,7 +238,9 @@ func (sess *session) Exec(ctx context.Context, cmd *packet2.Command, callback si
 	if err != nil {
 		return fmt.Errorf("open stream error session %s err %w", sess.ID(), err)
 	}
+	sess.streams.Add(1)
 	defer func() {
+		sess.streams.Add(-1)
 		stream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
 		sess.logger.Debug("close stream", "stream", stream.StreamID(), "cmd", cmd.Type)
 		err = stream.Close()
@@ -189,8 +256,8 @@ func (sess *session) Exec(ctx context.Context, cmd *packet2.Command, callback si
 	if err = protodelim.UnmarshalFrom(packet2.NewProtoReader(stream), &ret); err != nil {
 		return fmt.Errorf("read ret error %w", err)
 	}
-	if ret.ErrNo != silly_ctrl.NoError.Code() {
-		return silly_ctrl.ErrorNo(ret.ErrNo)
+	if err = silly_ctrl.ErrorFromRet(&ret); err != nil {
+		return err
 	}
 	if callback == nil {
 		return nil
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/creack/pty"
+	"github.com/irealing/silly-ctrl"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const shellOutputGrace = time.Second
+
+type shellService struct {
+}
+
+func (shellService) Type() packet.CommandType {
+	return packet.CommandType_SHELL
+}
+
+func (shell shellService) Invoke(ctx context.Context, command *packet.Command, sess silly_ctrl.Session, _ silly_ctrl.SessionManager, stream quic.Stream) error {
+	name, args := silly_ctrl.DefaultShell(), []string(nil)
+	if len(command.Args) > 0 {
+		name, args = command.Args[0], command.Args[1:]
+	}
+	dir, err := commandDir(command, sess)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TERM="+command.GetParamWithDefault("term", "xterm-256color"))
+	cmd.Env = append(cmd.Env, silly_ctrl.CommandEnv(command)...)
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
+		Rows: uint16(paramUint(command, "rows", 24)),
+		Cols: uint16(paramUint(command, "cols", 80)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = ptmx.Close()
+	}()
+	if _, err = protodelim.MarshalTo(stream, silly_ctrl.RetWithError(silly_ctrl.NoError)); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	writer := silly_ctrl.NewFrameWriter(stream)
+	go shell.input(stream, ptmx, cmd)
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		_, _ = io.Copy(writer.Writer(packet.FrameType_STDOUT), ptmx)
+	}()
+	err = cmd.Wait()
+	select {
+	case <-outputDone:
+	case <-time.After(shellOutputGrace):
+	}
+	stream.CancelRead(quic.StreamErrorCode(silly_ctrl.NoError))
+	return writer.Close(&packet.Frame{Type: packet.FrameType_EXIT, Code: int32(exitCode(err))})
+}
+
+// input 处理客户端发送的 STDIN/RESIZE/SIGNAL 帧
+func (shellService) input(stream quic.Stream, ptmx *os.File, cmd *exec.Cmd) {
+	reader := packet.NewProtoReader(stream)
+	for {
+		frame := &packet.Frame{}
+		if err := protodelim.UnmarshalFrom(reader, frame); err != nil {
+			return
+		}
+		switch frame.Type {
+		case packet.FrameType_STDIN:
+			if _, err := ptmx.Write(frame.Data); err != nil {
+				return
+			}
+		case packet.FrameType_RESIZE:
+			if frame.Size != nil {
+				_ = pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(frame.Size.Rows), Cols: uint16(frame.Size.Cols)})
+			}
+		case packet.FrameType_SIGNAL:
+			_ = cmd.Process.Signal(syscall.Signal(frame.Signal))
+		}
+	}
+}
+
+func paramUint(command *packet.Command, key string, val uint64) uint64 {
+	v, err := strconv.ParseUint(command.GetParamWithDefault(key, ""), 10, 16)
+	if err != nil || v == 0 {
+		return val
+	}
+	return v
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,116 @@
+package silly_ctrl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolvePath 将文件类命令(FS、FILE_GET、FILE_PUT)的路径映射为本地路径
+// 未配置 Root 时返回解析符号链接后的绝对路径;配置 Root 时 path 视为 Root 下的路径,解析符号链接后越出 Root 的路径被拒绝
+// follow 为 false 时不解析最后一级路径,用于 lstat、删除与重命名符号链接本身
+func (p *Policy) ResolvePath(path string, follow bool) (string, error) {
+	if p == nil || p.Root == "" {
+		return resolveAbs(path, follow)
+	}
+	root, err := filepath.EvalSymlinks(p.Root)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	joined := filepath.Join(root, filepath.Clean(string(filepath.Separator)+path))
+	if joined == root {
+		return root, nil
+	}
+	dir, base := filepath.Split(joined)
+	real, err := evalExisting(dir)
+	if err != nil {
+		return "", err
+	}
+	if !within(root, real) {
+		return "", fmt.Errorf("%w: path %s escapes root", PermissionDenied, path)
+	}
+	resolved := filepath.Join(real, base)
+	if follow {
+		if real, err = evalExisting(resolved); err != nil {
+			return "", err
+		}
+		if !within(root, real) {
+			return "", fmt.Errorf("%w: path %s escapes root", PermissionDenied, path)
+		}
+	}
+	return resolved, nil
+}
+
+// resolveAbs 解析已存在部分的符号链接,使策略匹配的路径与实际访问的路径一致,解析失败时拒绝
+func resolveAbs(path string, follow bool) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, base := filepath.Split(abs)
+	if base == "" || follow {
+		dir, base = abs, ""
+	}
+	real, err := evalExisting(dir)
+	if err != nil {
+		return "", fmt.Errorf("%w: resolve %s: %v", PermissionDenied, path, err)
+	}
+	return filepath.Join(real, base), nil
+}
+
+// evalExisting 解析 path 中已存在部分的符号链接,不存在的部分原样保留
+func evalExisting(path string) (string, error) {
+	// 去掉 filepath.Split 留下的末尾分隔符,否则 Dir 与 Base 会重复最后一级
+	path = filepath.Clean(path)
+	var rest []string
+	for {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// noSymlinkBelow 检查 base 与 target 之间已存在的各级路径均不是符号链接
+func noSymlinkBelow(base, target string) error {
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == "." {
+		return err
+	}
+	p := base
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%w: symlink %s", PermissionDenied, p)
+		}
+	}
+	return nil
+}
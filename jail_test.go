@@ -0,0 +1,78 @@
+package silly_ctrl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"escape":   outside,                        // 指向 Root 之外的目录
+		"inner":    filepath.Join(root, "sub"),     // 指向 Root 之内的目录
+		"relative": filepath.Join("..", "outside"), // 相对路径越出 Root
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		policy *Policy
+		path   string
+		follow bool
+		want   string // 为空时期望 PermissionDenied
+	}{
+		{"root", &Policy{Root: root}, "/", true, root},
+		{"plain", &Policy{Root: root}, "/sub/file", true, filepath.Join(root, "sub", "file")},
+		{"dot dot", &Policy{Root: root}, "../../etc/passwd", true, filepath.Join(root, "etc", "passwd")},
+		{"missing parent", &Policy{Root: root}, "/a/b/c", true, filepath.Join(root, "a", "b", "c")},
+		{"inner link", &Policy{Root: root}, "/inner/file", true, filepath.Join(root, "sub", "file")},
+		{"escape dir", &Policy{Root: root}, "/escape/file", false, ""},
+		{"escape relative", &Policy{Root: root}, "/relative/file", false, ""},
+		{"escape last follow", &Policy{Root: root}, "/escape", true, ""},
+		{"escape last nofollow", &Policy{Root: root}, "/escape", false, filepath.Join(root, "escape")},
+		{"no root", nil, filepath.Join(root, "sub", "file"), true, filepath.Join(root, "sub", "file")},
+		{"no root link", &Policy{}, filepath.Join(root, "escape", "file"), false, filepath.Join(outside, "file")},
+		{"no root last follow", &Policy{}, filepath.Join(root, "escape"), true, outside},
+		{"no root last nofollow", &Policy{}, filepath.Join(root, "escape"), false, filepath.Join(root, "escape")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.ResolvePath(tt.path, tt.follow)
+			if tt.want == "" {
+				if !errors.Is(err, PermissionDenied) {
+					t.Fatalf("ResolvePath(%s) = %s, %v, want %v", tt.path, got, err, PermissionDenied)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("ResolvePath(%s) = %s, %v, want %s", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePathLoop(t *testing.T) {
+	dir := t.TempDir()
+	loop := filepath.Join(dir, "loop")
+	if err := os.Symlink(loop, loop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Policy{}).ResolvePath(filepath.Join(loop, "file"), false); !errors.Is(err, PermissionDenied) {
+		t.Fatalf("ResolvePath() = %v, want %v", err, PermissionDenied)
+	}
+}
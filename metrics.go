@@ -0,0 +1,276 @@
+package silly_ctrl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// DurationBuckets 命令 stream 持续时间的直方图分桶(秒),隧道类命令可持续数小时
+var DurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800, 3600}
+
+// MetricVec 带标签的指标,按标签值区分序列
+type MetricVec struct {
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	buckets  []float64
+	volatile bool // 采集前清空,由采集回调重新填充
+	mu       sync.Mutex
+	series   map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64 // 直方图各分桶的计数,不累计
+	count  uint64
+}
+
+func (vec *MetricVec) get(labels []string) *metricSeries {
+	if len(labels) != len(vec.labels) {
+		panic(fmt.Sprintf("metric %s expects %d labels, got %d", vec.name, len(vec.labels), len(labels)))
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := vec.series[key]
+	if !ok {
+		s = &metricSeries{labels: append([]string(nil), labels...), counts: make([]uint64, len(vec.buckets))}
+		vec.series[key] = s
+	}
+	return s
+}
+
+// Add 计数器或仪表值增加 v
+func (vec *MetricVec) Add(v float64, labels ...string) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	vec.get(labels).value += v
+}
+
+// Set 设置仪表值,计数器仅用于采集时由外部累计值填充
+func (vec *MetricVec) Set(v float64, labels ...string) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	vec.get(labels).value = v
+}
+
+// Observe 直方图记录一个观测值
+func (vec *MetricVec) Observe(v float64, labels ...string) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	s := vec.get(labels)
+	if i := sort.SearchFloat64s(vec.buckets, v); i < len(vec.buckets) {
+		s.counts[i]++
+	}
+	s.value += v
+	s.count++
+}
+
+func (vec *MetricVec) reset() {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	vec.series = make(map[string]*metricSeries)
+}
+
+func (vec *MetricVec) write(w *bufio.Writer) {
+	vec.mu.Lock()
+	defer vec.mu.Unlock()
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", vec.name, vec.help, vec.name, vec.kind)
+	keys := make([]string, 0, len(vec.series))
+	for key := range vec.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := vec.series[key]
+		if vec.kind != metricHistogram {
+			_, _ = fmt.Fprintf(w, "%s%s %s\n", vec.name, vec.labelString(s.labels, "", ""), formatMetric(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range vec.buckets {
+			cumulative += s.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", vec.name, vec.labelString(s.labels, "le", formatMetric(bound)), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", vec.name, vec.labelString(s.labels, "le", "+Inf"), s.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", vec.name, vec.labelString(s.labels, "", ""), formatMetric(s.value))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", vec.name, vec.labelString(s.labels, "", ""), s.count)
+	}
+}
+
+func (vec *MetricVec) labelString(values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range vec.labels {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) < 1 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetric(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Metrics 运行指标,以 Prometheus 文本格式导出
+// 仅用到计数器、仪表与直方图的文本格式,为避免引入 client_golang 及其依赖而自行实现
+type Metrics struct {
+	mu         sync.Mutex
+	vecs       []*MetricVec
+	collectors []func()
+
+	Handshakes        *MetricVec // 握手次数,标签 direction、result
+	Commands          *MetricVec // 收到的命令数,标签 type、result
+	StreamDuration    *MetricVec // 命令 stream 的持续时间,标签 type
+	ForwardedBytes    *MetricVec // 转发的字节数,标签 app、kind,kind 为 stream 或 packet
+	OversizeDatagrams *MetricVec // 超出 datagram 大小限制、改经 stream 发送的数据报数
+	Sessions          *MetricVec // 活跃会话数,标签 app、direction
+	HeartbeatAge      *MetricVec // 距最近一次收到心跳的时间,标签 app、session
+	RTT               *MetricVec // QUIC 平滑往返时延,标签 app、session
+	LostPackets       *MetricVec // QUIC 丢包数,标签 app、session
+}
+
+// DefaultMetrics 节点内各模块共用的指标
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	m := &Metrics{}
+	m.Handshakes = m.NewVec("silly_ctrl_handshakes_total", "Handshakes by direction and result.", metricCounter, "direction", "result")
+	m.Commands = m.NewVec("silly_ctrl_commands_total", "Commands handled by type and result.", metricCounter, "type", "result")
+	m.StreamDuration = m.NewHistogram("silly_ctrl_stream_duration_seconds", "Duration of command streams.", DurationBuckets, "type")
+	m.ForwardedBytes = m.NewVec("silly_ctrl_forwarded_bytes_total", "Bytes relayed between streams, connections and packet flows.", metricCounter, "app", "kind")
+	m.OversizeDatagrams = m.NewVec("silly_ctrl_oversize_datagrams_total", "Packets too large for a QUIC datagram and sent on the command stream instead.", metricCounter)
+	m.Sessions = m.newVolatile("silly_ctrl_sessions", "Active sessions by App and direction.", metricGauge, "app", "direction")
+	m.HeartbeatAge = m.newVolatile("silly_ctrl_heartbeat_age_seconds", "Seconds since the last heartbeat received from the session.", metricGauge, "app", "session")
+	m.RTT = m.newVolatile("silly_ctrl_session_rtt_seconds", "Smoothed QUIC round trip time of the session.", metricGauge, "app", "session")
+	m.LostPackets = m.newVolatile("silly_ctrl_session_lost_packets_total", "QUIC packets declared lost on the session.", metricCounter, "app", "session")
+	return m
+}
+
+// NewVec 注册计数器或仪表,kind 为 counter 或 gauge
+func (m *Metrics) NewVec(name, help, kind string, labels ...string) *MetricVec {
+	return m.register(&MetricVec{name: name, help: help, kind: kind, labels: labels})
+}
+
+func (m *Metrics) NewHistogram(name, help string, buckets []float64, labels ...string) *MetricVec {
+	return m.register(&MetricVec{name: name, help: help, kind: metricHistogram, labels: labels, buckets: buckets})
+}
+
+func (m *Metrics) newVolatile(name, help, kind string, labels ...string) *MetricVec {
+	return m.register(&MetricVec{name: name, help: help, kind: kind, labels: labels, volatile: true})
+}
+
+func (m *Metrics) register(vec *MetricVec) *MetricVec {
+	vec.series = make(map[string]*metricSeries)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.vecs = append(m.vecs, vec)
+	return vec
+}
+
+// OnCollect 注册采集回调,每次导出前调用
+func (m *Metrics) OnCollect(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collectors = append(m.collectors, fn)
+}
+
+// CollectSessions 导出时按 manager 中的会话计算会话数、心跳间隔与连接统计
+func (m *Metrics) CollectSessions(manager SessionManager) {
+	m.OnCollect(func() {
+		now := time.Now()
+		for _, sess := range manager.List() {
+			app, direction := sess.App().AccessKey, "in"
+			if sess.IsRemote() {
+				direction = "out"
+			}
+			m.Sessions.Add(1, app, direction)
+			stats := sess.Stats()
+			if !stats.LastHeartbeat.IsZero() {
+				m.HeartbeatAge.Set(now.Sub(stats.LastHeartbeat).Seconds(), app, sess.ID())
+			}
+			if stats.RTT > 0 {
+				m.RTT.Set(stats.RTT.Seconds(), app, sess.ID())
+			}
+			m.LostPackets.Set(float64(stats.LostPackets), app, sess.ID())
+		}
+	})
+}
+
+// Write 以 Prometheus 文本格式写入全部指标
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, vec := range m.vecs {
+		if vec.volatile {
+			vec.reset()
+		}
+	}
+	for _, collect := range m.collectors {
+		collect()
+	}
+	writer := bufio.NewWriter(w)
+	for _, vec := range m.vecs {
+		vec.write(writer)
+	}
+	return writer.Flush()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.Write(w)
+}
+
+// MetricsInterceptor 按命令类型与结果统计命令数及 stream 持续时间
+func MetricsInterceptor(m *Metrics) ServiceInterceptor {
+	return TimingInterceptor(func(cmd *packet.Command, _ Session, elapsed time.Duration, err error) {
+		m.Commands.Add(1, cmd.Type.String(), ErrorLabel(err))
+		m.StreamDuration.Observe(elapsed.Seconds(), cmd.Type.String())
+	})
+}
+
+// ErrorLabel 将 error 转换为指标标签,非 ErrorNo 的错误计为 unknown
+func ErrorLabel(err error) string {
+	return ErrorNo(RetWithError(err).ErrNo).String()
+}
+
+// countWriter 统计写入的字节数
+type countWriter struct {
+	w         io.Writer
+	app, kind string
+}
+
+// CountingWriter 写入 w 的字节数计入 app 的 ForwardedBytes
+func CountingWriter(w io.Writer, app, kind string) io.Writer {
+	return countWriter{w: w, app: app, kind: kind}
+}
+
+func (cw countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	DefaultMetrics.ForwardedBytes.Add(float64(n), cw.app, cw.kind)
+	return n, err
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"os/user"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -62,6 +64,17 @@ func (x *Command) GetParamWithDefault(key, val string) string {
 	return r
 }
 
+func (x *Command) SetParam(key, val string) *Command {
+	for _, param := range x.Params {
+		if param.Key == key {
+			param.Value = val
+			return x
+		}
+	}
+	x.Params = append(x.Params, &CommandParam{Key: key, Value: val})
+	return x
+}
+
 // ForwardCommand FORWARD <REMOTE> <ADDRESS>
 // like FORWARD xxx 127.0.0.1:8000
 func ForwardCommand(remote, addr string) *Command {
@@ -70,3 +83,80 @@ func ForwardCommand(remote, addr string) *Command {
 		Args: []string{remote, addr},
 	}
 }
+
+// ForwardRouteCommand FORWARD <HOP1> <ADDRESS> route=<HOP2,HOP3...>
+// 依次经过 route 中的会话(AccessKey 或会话 ID),最后一跳对 ADDRESS 执行 PROXY,route 不能为空
+func ForwardRouteCommand(route []string, addr string) *Command {
+	cmd := ForwardCommand(route[0], addr)
+	if len(route) > 1 {
+		cmd.SetParam("route", strings.Join(route[1:], ","))
+	}
+	return cmd
+}
+
+// FileGetCommand FILE_GET <PATH>,对端发送 PATH 指向的文件或目录
+func FileGetCommand(path string) *Command {
+	return &Command{Type: CommandType_FILE_GET, Args: []string{path}}
+}
+
+// FilePutCommand FILE_PUT <PATH> [resume=true],对端接收文件写入 PATH
+func FilePutCommand(path string, resume bool) *Command {
+	return (&Command{Type: CommandType_FILE_PUT, Args: []string{path}}).SetParam("resume", strconv.FormatBool(resume))
+}
+
+const (
+	FsOpStat   = "stat"   // FS stat <PATH>,不跟随最后一级符号链接
+	FsOpList   = "list"   // FS list <PATH>
+	FsOpMkdir  = "mkdir"  // FS mkdir <PATH> [parents=true]
+	FsOpRemove = "remove" // FS remove <PATH> [recursive=true]
+	FsOpRename = "rename" // FS rename <PATH> <NEWPATH>
+)
+
+// FsCommand FS <OP> <PATH> [NEWPATH]
+func FsCommand(op string, paths ...string) *Command {
+	return &Command{Type: CommandType_FS, Args: append([]string{op}, paths...)}
+}
+
+const (
+	EchoModeReflect = "reflect" // 原样回显
+	EchoModePing    = "ping"    // 逐条回显 EchoPing 用于测量 RTT
+	EchoModeBulk    = "bulk"    // 接收数据并返回 EchoStat 用于测量吞吐
+)
+
+// EchoCommand ECHO mode=<MODE>
+func EchoCommand(mode string) *Command {
+	return &Command{
+		Type:   CommandType_ECHO,
+		Params: []*CommandParam{{Key: "mode", Value: mode}},
+	}
+}
+
+// ShellCommand SHELL [PROGRAM [ARGS...]]
+// 未指定程序时使用远端默认 shell
+func ShellCommand(term string, size *WindowSize, args ...string) *Command {
+	cmd := &Command{Type: CommandType_SHELL, Args: args}
+	if term != "" {
+		cmd.SetParam("term", term)
+	}
+	if size != nil {
+		cmd.SetParam("rows", strconv.FormatUint(uint64(size.Rows), 10))
+		cmd.SetParam("cols", strconv.FormatUint(uint64(size.Cols), 10))
+	}
+	return cmd
+}
+
+// ExecCommand EXEC <PROGRAM> [ARGS...]
+func ExecCommand(args ...string) *Command {
+	return &Command{Type: CommandType_EXEC, Args: args}
+}
+
+// ProxyCommand PROXY <ADDRESS> network=<NETWORK>
+func ProxyCommand(network, addr string) *Command {
+	return (&Command{Type: CommandType_PROXY, Args: []string{addr}}).SetParam("network", network)
+}
+
+// ListenCommand LISTEN <NETWORK> <ADDRESS> target=<TARGET>
+// 对端监听 ADDRESS,每个连接通过 PROXY TARGET 回连发起方
+func ListenCommand(network, addr, target string) *Command {
+	return (&Command{Type: CommandType_LISTEN, Args: []string{network, addr}}).SetParam("target", target)
+}
@@ -0,0 +1,152 @@
+package silly_ctrl
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// CertRequest 签发证书的参数
+type CertRequest struct {
+	CommonName string
+	Hosts      []string // 写入 SAN 的 DNS 名、IP、URI 或 Email
+	CA         bool
+	Server     bool // 用于 TLS 服务端
+	Client     bool // 用于 TLS 客户端,即 mTLS 的 Agent 身份
+	Validity   time.Duration
+}
+
+func (req *CertRequest) template() (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: req.CommonName},
+		NotBefore:             now.Add(-time.Minute * 5),
+		NotAfter:              now.Add(req.Validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	if req.CA {
+		tpl.IsCA = true
+		tpl.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if req.Server {
+		tpl.ExtKeyUsage = append(tpl.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if req.Client {
+		tpl.ExtKeyUsage = append(tpl.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	for _, host := range req.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else if u, err := url.Parse(host); err == nil && u.Scheme != "" && u.Host != "" {
+			tpl.URIs = append(tpl.URIs, u)
+		} else if strings.Contains(host, "@") {
+			tpl.EmailAddresses = append(tpl.EmailAddresses, host)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, host)
+		}
+	}
+	return tpl, nil
+}
+
+// CreateCertificate 生成 ECDSA P-256 密钥并签发证书,parent 为空时自签名
+func CreateCertificate(req *CertRequest, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tpl, err := req.template()
+	if err != nil {
+		return nil, nil, err
+	}
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// WriteKeyPair 以 PEM 格式写入证书与私钥,私钥文件权限为 0600
+func WriteKeyPair(certFile, keyFile string, cert *x509.Certificate, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644)
+}
+
+// LoadKeyPair 读取 PEM 格式的证书与私钥
+func LoadKeyPair(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	cert, err := readPEM(certFile, "CERTIFICATE")
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := readPEM(keyFile, "PRIVATE KEY")
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: unsupported private key", keyFile)
+	}
+	return parsed, signer, nil
+}
+
+func readPEM(filename, blockType string) ([]byte, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(buf); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no %s block", filename, blockType)
+}
+
+// CreateCRL 由 CA 签发吊销列表,返回 PEM 格式内容
+func CreateCRL(ca *x509.Certificate, caKey crypto.Signer, number int64, revoked []x509.RevocationListEntry, validity time.Duration) ([]byte, error) {
+	now := time.Now()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(validity),
+		RevokedCertificateEntries: revoked,
+	}, ca, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
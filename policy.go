@@ -0,0 +1,313 @@
+package silly_ctrl
+
+import (
+	"context"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Policy App 的命令授权策略
+// 规则列表为空表示不限制;以 ! 开头的规则表示拒绝,拒绝规则优先于允许规则
+type Policy struct {
+	Commands  []string // 允许的命令类型,如 EXEC、PROXY
+	Exec      []string // EXEC/SHELL 可执行文件路径,支持 glob,SHELL 未指定程序时匹配默认 shell
+	Env       []string // EXEC/SHELL 可通过 env 参数设置的环境变量名,支持 glob,为空时禁止 defaultEnvRules 中的变量
+	Proxy     []string // PROXY 目标地址,格式为 HOST:PORT,HOST 可为 CIDR、IP、域名 glob 或 *,PORT 可为 *、单个端口或 1000-2000
+	Forward   []string // FORWARD 目标会话及 route 中各跳(AccessKey 或会话 ID),支持 glob
+	Listen    []string // LISTEN 监听地址,格式同 Proxy
+	Routes    []string // 接受对端 ROUTE 通告的 AccessKey,支持 glob,为空时(含 Policy 为空)不接受任何通告
+	Advertise []string // 向对端 ROUTE 通告的 AccessKey,支持 glob,为空时(含 Policy 为空)不向对端通告
+	Files     []string // FS/FILE_GET/FILE_PUT 及 EXEC/SHELL dir 参数的路径,规则为目录前缀或 glob,匹配 Root 映射后的本地路径
+	Root      string   // FS/FILE_GET/FILE_PUT 及 EXEC/SHELL dir 参数的根目录,为空时不限制
+}
+
+// defaultEnvRules 未配置 Env 时禁止设置的环境变量,这些变量可改变动态链接或 shell 加载的程序
+var defaultEnvRules = []string{"!LD_*", "!DYLD_*", "!PATH", "!IFS", "!ENV", "!BASH_ENV", "!SHELLOPTS", "!BASHOPTS", "!PS4", "!GCONV_PATH"}
+
+// Check 校验命令是否被策略允许
+func (p *Policy) Check(ctx context.Context, cmd *packet.Command) error {
+	if p == nil {
+		return nil
+	}
+	if !allowed(p.Commands, func(rule string) bool {
+		return strings.EqualFold(rule, cmd.Type.String())
+	}) {
+		return fmt.Errorf("%w: command %s", PermissionDenied, cmd.Type)
+	}
+	switch cmd.Type {
+	case packet.CommandType_EXEC, packet.CommandType_SHELL:
+		return p.checkExec(cmd)
+	case packet.CommandType_PROXY:
+		if len(cmd.Args) > 0 {
+			return checkAddress(ctx, p.Proxy, "proxy", cmd.Args[0])
+		}
+	case packet.CommandType_LISTEN:
+		if len(cmd.Args) > 1 {
+			return checkAddress(ctx, p.Listen, "listen", cmd.Args[1])
+		}
+	case packet.CommandType_FILE_GET, packet.CommandType_FILE_PUT:
+		if len(cmd.Args) > 0 {
+			return p.checkFile(cmd.Args[0], true)
+		}
+	case packet.CommandType_FS:
+		// FS <OP> <PATH> [NEWPATH],与 fsService 相同,仅 LIST 解析 PATH 最后一级的符号链接
+		for i, path := range cmd.Args[min(len(cmd.Args), 1):] {
+			if err := p.checkFile(path, i == 0 && cmd.Args[0] == packet.FsOpList); err != nil {
+				return err
+			}
+		}
+	case packet.CommandType_FORWARD:
+		if len(cmd.Args) < 1 {
+			break
+		}
+		// 首跳与 route 中的后续各跳均需命中 Forward 规则,后续节点只能看到本节点的 App
+		for _, hop := range append([]string{cmd.Args[0]}, SplitList(cmd.GetParamWithDefault("route", ""))...) {
+			if !allowed(p.Forward, globMatcher(hop)) {
+				return fmt.Errorf("%w: forward %s", PermissionDenied, hop)
+			}
+		}
+	default:
+	}
+	return nil
+}
+
+// checkExec 校验 EXEC/SHELL 的程序、env 与 dir 参数
+func (p *Policy) checkExec(cmd *packet.Command) error {
+	name := ""
+	if len(cmd.Args) > 0 {
+		name = cmd.Args[0]
+	} else if cmd.Type == packet.CommandType_SHELL {
+		name = DefaultShell()
+	}
+	if name != "" && !p.allowExec(name) {
+		return fmt.Errorf("%w: exec %s", PermissionDenied, name)
+	}
+	rules := p.Env
+	if len(rules) < 1 {
+		rules = defaultEnvRules
+	}
+	for _, env := range CommandEnv(cmd) {
+		key, _, _ := strings.Cut(env, "=")
+		if !allowed(rules, globMatcher(key)) {
+			return fmt.Errorf("%w: env %s", PermissionDenied, key)
+		}
+	}
+	if dir, ok := cmd.GetParam("dir"); ok && dir != "" {
+		return p.checkFile(dir, true)
+	}
+	return nil
+}
+
+// AllowRoute 是否接受对端对 accessKey 的路由通告,路由通告须显式授权
+func (p *Policy) AllowRoute(accessKey string) bool {
+	return p != nil && len(p.Routes) > 0 && allowed(p.Routes, globMatcher(accessKey))
+}
+
+// AllowAdvert 是否向对端通告 accessKey 可经本节点到达,通告须显式授权
+func (p *Policy) AllowAdvert(accessKey string) bool {
+	return p != nil && len(p.Advertise) > 0 && allowed(p.Advertise, globMatcher(accessKey))
+}
+
+func (p *Policy) allowExec(name string) bool {
+	candidates := []string{filepath.Clean(name)}
+	if path, err := exec.LookPath(name); err == nil {
+		if abs, err := filepath.Abs(path); err == nil && abs != candidates[0] {
+			candidates = append(candidates, abs)
+		}
+	}
+	return allowedAny(p.Exec, candidates, func(rule, candidate string) bool {
+		ok, _ := filepath.Match(rule, candidate)
+		return ok
+	})
+}
+
+// checkFile 以与服务相同的 follow 解析路径后匹配 Files 规则
+func (p *Policy) checkFile(name string, follow bool) error {
+	path, err := p.ResolvePath(name, follow)
+	if err != nil {
+		return err
+	}
+	if !p.allowFile(path) {
+		return fmt.Errorf("%w: file %s", PermissionDenied, name)
+	}
+	return nil
+}
+
+// allowFile 路径等于规则或位于规则目录之下时命中,规则也可为 glob
+func (p *Policy) allowFile(path string) bool {
+	return allowed(p.Files, func(rule string) bool {
+		rule = filepath.Clean(rule)
+		if path == rule || strings.HasPrefix(path, strings.TrimSuffix(rule, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+		ok, _ := filepath.Match(rule, path)
+		return ok
+	})
+}
+
+func checkAddress(ctx context.Context, rules []string, kind, address string) error {
+	if len(rules) < 1 {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return BadParamError
+	}
+	var ips []net.IP
+	if host == "" {
+		ips = []net.IP{net.IPv4zero, net.IPv6unspecified}
+	} else if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if ips, err = net.DefaultResolver.LookupIP(ctx, "ip", host); err != nil {
+		return fmt.Errorf("%w: resolve %s", PermissionDenied, host)
+	}
+	target := &addressTarget{host: host, port: port, ips: ips}
+	if !allowedTarget(rules, target) {
+		return fmt.Errorf("%w: %s %s", PermissionDenied, kind, address)
+	}
+	return nil
+}
+
+// ProxyDialer 返回连接 address 的 Dialer,在建立连接前按 Proxy 规则校验实际连接的 IP
+// Check 与 Dial 分别解析域名,仅校验 Check 时的解析结果会被 DNS 重绑定绕过
+func (p *Policy) ProxyDialer(address string) *net.Dialer {
+	if p == nil || len(p.Proxy) < 1 {
+		return &net.Dialer{}
+	}
+	return &net.Dialer{Control: addressControl(p.Proxy, "proxy", address)}
+}
+
+// ListenConfig 返回监听 address 的 ListenConfig,在绑定前按 Listen 规则校验实际绑定的 IP
+func (p *Policy) ListenConfig(address string) *net.ListenConfig {
+	if p == nil || len(p.Listen) < 1 {
+		return &net.ListenConfig{}
+	}
+	return &net.ListenConfig{Control: addressControl(p.Listen, "listen", address)}
+}
+
+// addressControl 域名规则仍按 address 中的 host 匹配,IP 与 CIDR 规则按系统调用前的地址匹配
+func addressControl(rules []string, kind, address string) func(network, addr string, c syscall.RawConn) error {
+	host, _, _ := net.SplitHostPort(address)
+	return func(network, addr string, _ syscall.RawConn) error {
+		ip, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("%w: %s %s", PermissionDenied, kind, addr)
+		}
+		target := &addressTarget{host: host, port: port, ips: []net.IP{net.ParseIP(ip)}}
+		if target.ips[0] == nil || !allowedTarget(rules, target) {
+			return fmt.Errorf("%w: %s %s", PermissionDenied, kind, addr)
+		}
+		return nil
+	}
+}
+
+type addressTarget struct {
+	host string
+	port string
+	ips  []net.IP
+}
+
+// match 允许规则要求全部解析地址命中,拒绝规则命中任一地址即生效
+func (target *addressTarget) match(rule string, deny bool) bool {
+	host, port, err := net.SplitHostPort(rule)
+	if err != nil || !matchPort(port, target.port) {
+		return false
+	}
+	if host == "*" {
+		return true
+	}
+	var network *net.IPNet
+	if _, n, err := net.ParseCIDR(host); err == nil {
+		network = n
+	} else if ip := net.ParseIP(host); ip != nil {
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	} else {
+		ok, _ := filepath.Match(host, target.host)
+		return ok
+	}
+	for _, ip := range target.ips {
+		if network.Contains(ip) == deny {
+			return deny
+		}
+	}
+	return !deny
+}
+
+func matchPort(rule, port string) bool {
+	if rule == "*" || rule == port {
+		return true
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return false
+	}
+	low, high, ok := strings.Cut(rule, "-")
+	if !ok {
+		return false
+	}
+	l, err := strconv.Atoi(low)
+	if err != nil {
+		return false
+	}
+	h, err := strconv.Atoi(high)
+	if err != nil {
+		return false
+	}
+	return p >= l && p <= h
+}
+
+func globMatcher(val string) func(rule string) bool {
+	return func(rule string) bool {
+		ok, _ := filepath.Match(rule, val)
+		return ok
+	}
+}
+
+// allowed 规则为空时允许;命中任一拒绝规则时拒绝;存在允许规则时需至少命中一条
+func allowed(rules []string, match func(rule string) bool) bool {
+	return allowedRules(rules, func(rule string, _ bool) bool {
+		return match(rule)
+	})
+}
+
+// allowedAny 任一候选值命中拒绝规则即拒绝,任一候选值命中允许规则即允许
+func allowedAny(rules []string, candidates []string, match func(rule, candidate string) bool) bool {
+	return allowedRules(rules, func(rule string, _ bool) bool {
+		for _, candidate := range candidates {
+			if match(rule, candidate) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func allowedTarget(rules []string, target *addressTarget) bool {
+	return allowedRules(rules, target.match)
+}
+
+func allowedRules(rules []string, match func(rule string, deny bool) bool) bool {
+	if len(rules) < 1 {
+		return true
+	}
+	allow, hasAllow := false, false
+	for _, rule := range rules {
+		if deny, ok := strings.CutPrefix(rule, "!"); ok {
+			if match(deny, true) {
+				return false
+			}
+			continue
+		}
+		hasAllow = true
+		if !allow && match(rule, false) {
+			allow = true
+		}
+	}
+	return allow || !hasAllow
+}
@@ -0,0 +1,177 @@
+package silly_ctrl
+
+import (
+	"context"
+	"errors"
+	"github.com/irealing/silly-ctrl/packet"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	secret := filepath.Join(dir, "secret")
+	for _, d := range []string{data, secret} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(secret, "key"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(data, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(secret, "key"), filepath.Join(data, "key")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		policy *Policy
+		cmd    *packet.Command
+		allow  bool
+	}{
+		{"nil policy", nil, packet.ExecCommand("/bin/rm"), true},
+		{"command allowed", &Policy{Commands: []string{"exec"}}, packet.ExecCommand("/bin/true"), true},
+		{"command denied", &Policy{Commands: []string{"EXEC"}}, packet.ProxyCommand("tcp", "127.0.0.1:22"), false},
+		{"command deny rule", &Policy{Commands: []string{"!SHELL"}}, packet.ShellCommand("", nil), false},
+		{"exec allowed", &Policy{Exec: []string{"/usr/bin/*"}}, packet.ExecCommand("/usr/bin/uptime"), true},
+		{"exec denied", &Policy{Exec: []string{"/usr/bin/uptime"}}, packet.ExecCommand("/bin/sh", "-c", "id"), false},
+		{"exec deny rule", &Policy{Exec: []string{"/usr/bin/*", "!/usr/bin/curl"}}, packet.ExecCommand("/usr/bin/curl"), false},
+		{"shell default denied", &Policy{Exec: []string{"/usr/bin/uptime"}}, packet.ShellCommand("", nil), false},
+		{"shell default allowed", &Policy{Exec: []string{"/bin/sh"}}, packet.ShellCommand("", nil), true},
+		{"env allowed", &Policy{}, packet.ExecCommand("/bin/true").SetParam("env", "LANG=C;TZ=UTC"), true},
+		{"env LD_PRELOAD", &Policy{}, packet.ExecCommand("/bin/true").SetParam("env", "LD_PRELOAD=/tmp/x.so"), false},
+		{"env PATH", &Policy{}, packet.ShellCommand("", nil).SetParam("env", "LANG=C;PATH=/tmp"), false},
+		{"env allowlist", &Policy{Env: []string{"LANG", "LC_*"}}, packet.ExecCommand("/bin/true").SetParam("env", "TZ=UTC"), false},
+		{"env allowlist match", &Policy{Env: []string{"LANG", "LC_*"}}, packet.ExecCommand("/bin/true").SetParam("env", "LC_ALL=C"), true},
+		{"dir allowed", &Policy{Files: []string{data}}, packet.ExecCommand("/bin/true").SetParam("dir", data), true},
+		{"dir denied", &Policy{Files: []string{data}}, packet.ExecCommand("/bin/true").SetParam("dir", secret), false},
+		{"dir symlink", &Policy{Files: []string{data}}, packet.ExecCommand("/bin/true").SetParam("dir", filepath.Join(data, "dir")), false},
+		{"proxy allowed", &Policy{Proxy: []string{"10.0.0.0/8:*"}}, packet.ProxyCommand("tcp", "10.1.2.3:80"), true},
+		{"proxy port range", &Policy{Proxy: []string{"*:8000-9000"}}, packet.ProxyCommand("tcp", "10.1.2.3:22"), false},
+		{"proxy deny rule", &Policy{Proxy: []string{"*:*", "!127.0.0.0/8:*"}}, packet.ProxyCommand("tcp", "127.0.0.1:22"), false},
+		{"listen allowed", &Policy{Listen: []string{"127.0.0.1:9000"}}, packet.ListenCommand("tcp", "127.0.0.1:9000", "127.0.0.1:22"), true},
+		{"listen denied", &Policy{Listen: []string{"127.0.0.1:9000"}}, packet.ListenCommand("tcp", "0.0.0.0:9000", "127.0.0.1:22"), false},
+		{"file allowed", &Policy{Files: []string{data}}, packet.FileGetCommand(filepath.Join(data, "new")), true},
+		{"file denied", &Policy{Files: []string{data}}, packet.FileGetCommand(filepath.Join(secret, "key")), false},
+		{"file dir symlink", &Policy{Files: []string{data}}, packet.FileGetCommand(filepath.Join(data, "dir", "key")), false},
+		{"file last symlink", &Policy{Files: []string{data}}, packet.FilePutCommand(filepath.Join(data, "key"), false), false},
+		{"fs remove symlink", &Policy{Files: []string{data}}, packet.FsCommand(packet.FsOpRemove, filepath.Join(data, "key")), true},
+		{"fs list symlink", &Policy{Files: []string{data}}, packet.FsCommand(packet.FsOpList, filepath.Join(data, "dir")), false},
+		{"forward allowed", &Policy{Forward: []string{"agent-*"}}, packet.ForwardCommand("agent-1", "127.0.0.1:22"), true},
+		{"forward denied", &Policy{Forward: []string{"agent-*"}}, packet.ForwardCommand("db", "127.0.0.1:22"), false},
+		{"forward route allowed", &Policy{Forward: []string{"agent-*"}}, packet.ForwardRouteCommand([]string{"agent-1", "agent-2"}, "127.0.0.1:22"), true},
+		{"forward route denied", &Policy{Forward: []string{"agent-*"}}, packet.ForwardRouteCommand([]string{"agent-1", "db"}, "127.0.0.1:22"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(context.Background(), tt.cmd)
+			if tt.allow && err != nil {
+				t.Fatalf("Check() = %v, want allowed", err)
+			}
+			if !tt.allow && !errors.Is(err, PermissionDenied) {
+				t.Fatalf("Check() = %v, want %v", err, PermissionDenied)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowRoute(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *Policy
+		accessKey string
+		allow     bool
+	}{
+		{"nil policy", nil, "agent", false},
+		{"no rules", &Policy{}, "agent", false},
+		{"match", &Policy{Routes: []string{"agent-*"}}, "agent-1", true},
+		{"no match", &Policy{Routes: []string{"agent-*"}}, "controller", false},
+		{"deny rule", &Policy{Routes: []string{"*", "!controller"}}, "controller", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.AllowRoute(tt.accessKey); got != tt.allow {
+				t.Fatalf("AllowRoute(%s) = %v, want %v", tt.accessKey, got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestPolicyAddressControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		address string // 命令中的地址
+		dial    string // 解析后实际连接的地址
+		allow   bool
+	}{
+		{"nil policy", nil, "rebind.example:80", "127.0.0.1:80", true},
+		{"ip allowed", &Policy{Proxy: []string{"10.0.0.0/8:*"}}, "rebind.example:80", "10.1.2.3:80", true},
+		{"rebind outside allow", &Policy{Proxy: []string{"10.0.0.0/8:*"}}, "rebind.example:80", "127.0.0.1:80", false},
+		{"rebind deny rule", &Policy{Proxy: []string{"*:*", "!169.254.169.254/32:*"}}, "rebind.example:80", "169.254.169.254:80", false},
+		{"domain rule", &Policy{Proxy: []string{"*.example:443"}}, "db.example:443", "10.1.2.3:443", true},
+		{"port denied", &Policy{Proxy: []string{"*:443"}}, "db.example:443", "10.1.2.3:80", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			control := tt.policy.ProxyDialer(tt.address).Control
+			var err error
+			if control != nil {
+				err = control("tcp", tt.dial, nil)
+			}
+			if tt.allow && err != nil {
+				t.Fatalf("Control(%s) = %v, want allowed", tt.dial, err)
+			}
+			if !tt.allow && !errors.Is(err, PermissionDenied) {
+				t.Fatalf("Control(%s) = %v, want %v", tt.dial, err, PermissionDenied)
+			}
+		})
+	}
+}
+
+func TestPolicyProxyDialerLocalhost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	policy := &Policy{Proxy: []string{"*:*", "!127.0.0.0/8:*", "!::1/128:*"}}
+	// localhost 解析为回环地址,连接前应被拒绝规则拦截
+	if conn, err := policy.ProxyDialer("localhost:"+port).Dial("tcp", "localhost:"+port); !errors.Is(err, PermissionDenied) {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		t.Fatalf("Dial(localhost) = %v, want %v", err, PermissionDenied)
+	}
+}
+
+func TestPolicyAllowAdvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *Policy
+		accessKey string
+		allow     bool
+	}{
+		{"nil policy", nil, "agent", false},
+		{"no rules", &Policy{Routes: []string{"*"}}, "agent", false},
+		{"match", &Policy{Advertise: []string{"agent-*"}}, "agent-1", true},
+		{"no match", &Policy{Advertise: []string{"agent-*"}}, "db", false},
+		{"deny rule", &Policy{Advertise: []string{"*", "!db"}}, "db", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.AllowAdvert(tt.accessKey); got != tt.allow {
+				t.Fatalf("AllowAdvert(%s) = %v, want %v", tt.accessKey, got, tt.allow)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package silly_ctrl
+
+import "time"
+
+// Route 经下一跳会话间接可达的 AccessKey
+type Route struct {
+	AccessKey string    `json:"access_key"`
+	Session   string    `json:"session"` // 下一跳会话 ID
+	Node      string    `json:"node"`    // 下一跳节点标识
+	Hops      int       `json:"hops"`    // 到达 AccessKey 需经过的节点数
+	ExpireAt  time.Time `json:"expire_at"`
+}
+
+// RouteTable 由 ROUTE 通告学习到的路由表,直连会话不在表中
+type RouteTable interface {
+	// Update 以 session 的最新通告替换其全部路由,entries 为 AccessKey 到跳数的映射
+	Update(session, node string, entries map[string]int, ttl time.Duration)
+	Remove(session string)
+	Lookup(accessKey string) (Route, bool) // Lookup 返回跳数最少的未过期路由
+	Dump() []Route
+}
+
+// Resolve 优先选择直连会话,不存在时按路由表选择下一跳会话
+func Resolve(manager SessionManager, id string, policy SelectPolicy) (Session, bool) {
+	if sess, ok := manager.Select(id, policy); ok {
+		return sess, true
+	}
+	route, ok := manager.Routes().Lookup(id)
+	if !ok {
+		return nil, false
+	}
+	return manager.Get(route.Session)
+}
@@ -0,0 +1,310 @@
+package silly_ctrl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"github.com/quic-go/quic-go"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const partSuffix = ".part"
+
+// TransferStat 文件传输统计
+type TransferStat struct {
+	Files   int   // 传输完成的文件数
+	Dirs    int   // 创建的目录数
+	Bytes   int64 // 实际传输的字节数
+	Resumed int64 // 断点续传跳过的字节数
+}
+
+type fileSender struct {
+	stream quic.Stream
+	reader protodelim.Reader
+	stat   TransferStat
+}
+
+// SendFiles 发送 src 指向的文件或目录,目录递归发送,符号链接等非常规文件被忽略
+func SendFiles(stream quic.Stream, src string) (*TransferStat, error) {
+	sender := &fileSender{stream: stream, reader: packet.NewProtoReader(stream)}
+	rootName := filepath.Base(filepath.Clean(src))
+	root, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		_, _ = protodelim.MarshalTo(stream, &packet.FileMessage{Ret: RetWithError(err)})
+		return &sender.stat, err
+	}
+	// 对端返回的错误与传输数据期间的错误无法再通知对端
+	var silent bool
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := rootName
+		if rel != "." {
+			name = path.Join(rootName, filepath.ToSlash(rel))
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			header := &packet.FileHeader{Path: name, Mode: uint32(info.Mode().Perm()), Mtime: info.ModTime().UnixNano(), Dir: true}
+			reply, err := sender.exchange(&packet.FileMessage{Header: header})
+			if err == nil {
+				err = ErrorFromRet(reply.Ret)
+			}
+			if err != nil {
+				silent = true
+				return err
+			}
+			sender.stat.Dirs++
+		case info.Mode().IsRegular():
+			if err = sender.sendFile(p, name, info, &silent); err != nil {
+				return err
+			}
+		default:
+		}
+		return nil
+	})
+	if err != nil {
+		if !silent {
+			_, _ = protodelim.MarshalTo(stream, &packet.FileMessage{Ret: RetWithError(err)})
+		}
+		return &sender.stat, err
+	}
+	_, err = protodelim.MarshalTo(stream, &packet.FileMessage{End: true})
+	return &sender.stat, err
+}
+
+func (sender *fileSender) exchange(msg *packet.FileMessage) (*packet.FileMessage, error) {
+	if _, err := protodelim.MarshalTo(sender.stream, msg); err != nil {
+		return nil, err
+	}
+	reply := &packet.FileMessage{}
+	if err := protodelim.UnmarshalFrom(sender.reader, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (sender *fileSender) sendFile(p, name string, info fs.FileInfo, silent *bool) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	size := info.Size()
+	header := &packet.FileHeader{Path: name, Size: uint64(size), Mode: uint32(info.Mode().Perm()), Mtime: info.ModTime().UnixNano()}
+	reply, err := sender.exchange(&packet.FileMessage{Header: header})
+	if err != nil {
+		*silent = true
+		return err
+	}
+	if reply.Ret != nil {
+		*silent = true
+		if err = ErrorFromRet(reply.Ret); err == nil {
+			err = BadParamError
+		}
+		return err
+	}
+	offset := int64(reply.Offset)
+	if offset > size {
+		return fmt.Errorf("%w: offset %d exceeds size %d", BadParamError, offset, size)
+	}
+	h := sha256.New()
+	if _, err = io.CopyN(h, f, offset); err != nil {
+		return err
+	}
+	*silent = true
+	if _, err = io.CopyN(io.MultiWriter(sender.stream, h), f, size-offset); err != nil {
+		return err
+	}
+	if reply, err = sender.exchange(&packet.FileMessage{Sha256: h.Sum(nil)}); err != nil {
+		return err
+	}
+	if err = ErrorFromRet(reply.Ret); err != nil {
+		return err
+	}
+	*silent = false
+	sender.stat.Files++
+	sender.stat.Bytes += size - offset
+	sender.stat.Resumed += offset
+	return nil
+}
+
+type fileReceiver struct {
+	stream     quic.Stream
+	reader     protodelim.Reader
+	dest       string
+	resume     bool
+	rootName   string
+	rootTarget string
+	stat       TransferStat
+}
+
+// ReceiveFiles 接收 SendFiles 发送的文件写入 dest
+// dest 为已存在的目录时写入 dest 下的同名文件或目录,否则写入 dest 本身
+// 文件先写入 .part 临时文件,校验通过后重命名;resume 为 true 时从已有的 .part 文件续传
+func ReceiveFiles(stream quic.Stream, dest string, resume bool) (*TransferStat, error) {
+	receiver := &fileReceiver{stream: stream, reader: packet.NewProtoReader(stream), dest: dest, resume: resume}
+	for {
+		msg := &packet.FileMessage{}
+		if err := protodelim.UnmarshalFrom(receiver.reader, msg); err != nil {
+			return &receiver.stat, err
+		}
+		if msg.End {
+			return &receiver.stat, nil
+		}
+		if msg.Ret != nil {
+			err := ErrorFromRet(msg.Ret)
+			if err == nil {
+				err = BadParamError
+			}
+			return &receiver.stat, err
+		}
+		if msg.Header == nil {
+			return &receiver.stat, BadParamError
+		}
+		if err := receiver.receive(msg.Header); err != nil {
+			return &receiver.stat, err
+		}
+	}
+}
+
+func (receiver *fileReceiver) reply(msg *packet.FileMessage) error {
+	_, err := protodelim.MarshalTo(receiver.stream, msg)
+	return err
+}
+
+// fail 通知发送方并返回 err
+func (receiver *fileReceiver) fail(err error) error {
+	_ = receiver.reply(&packet.FileMessage{Ret: RetWithError(err)})
+	return err
+}
+
+// target 将发送方的相对路径映射为本地路径,拒绝绝对路径与 .. 等越界路径
+func (receiver *fileReceiver) target(name string) (string, error) {
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("%w: path %s", BadParamError, name)
+	}
+	first, rest, _ := strings.Cut(name, "/")
+	if receiver.rootName == "" {
+		receiver.rootName = first
+		receiver.rootTarget = receiver.dest
+		if info, err := os.Stat(receiver.dest); err == nil && info.IsDir() {
+			receiver.rootTarget = filepath.Join(receiver.dest, first)
+		}
+	}
+	if first != receiver.rootName {
+		return "", fmt.Errorf("%w: path %s", BadParamError, name)
+	}
+	target := filepath.Join(receiver.rootTarget, filepath.FromSlash(rest))
+	// 不跟随目标目录中已有的符号链接,避免写入目标目录之外
+	if err := noSymlinkBelow(receiver.rootTarget, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func (receiver *fileReceiver) receive(header *packet.FileHeader) error {
+	target, err := receiver.target(header.Path)
+	if err != nil {
+		return receiver.fail(err)
+	}
+	if header.Dir {
+		if err = os.MkdirAll(target, fs.FileMode(header.Mode).Perm()|0700); err != nil {
+			return receiver.fail(err)
+		}
+		receiver.stat.Dirs++
+		return receiver.reply(&packet.FileMessage{Ret: RetWithError(NoError)})
+	}
+	return receiver.receiveFile(target, header)
+}
+
+func (receiver *fileReceiver) receiveFile(target string, header *packet.FileHeader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return receiver.fail(err)
+	}
+	part := target + partSuffix
+	if err := noSymlinkBelow(receiver.rootTarget, part); err != nil {
+		return receiver.fail(err)
+	}
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return receiver.fail(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	h := sha256.New()
+	offset, err := receiver.resumeOffset(f, h, int64(header.Size))
+	if err != nil {
+		return receiver.fail(err)
+	}
+	if err = receiver.reply(&packet.FileMessage{Offset: uint64(offset)}); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(io.MultiWriter(f, h), receiver.stream, int64(header.Size)-offset); err != nil {
+		return err
+	}
+	trailer := &packet.FileMessage{}
+	if err = protodelim.UnmarshalFrom(receiver.reader, trailer); err != nil {
+		return err
+	}
+	if !bytes.Equal(trailer.Sha256, h.Sum(nil)) {
+		_ = f.Close()
+		_ = os.Remove(part)
+		return receiver.fail(fmt.Errorf("%w: %s", ChecksumError, header.Path))
+	}
+	if err = f.Close(); err != nil {
+		return receiver.fail(err)
+	}
+	if err = os.Rename(part, target); err != nil {
+		return receiver.fail(err)
+	}
+	_ = os.Chmod(target, fs.FileMode(header.Mode).Perm())
+	mtime := time.Unix(0, header.Mtime)
+	_ = os.Chtimes(target, mtime, mtime)
+	receiver.stat.Files++
+	receiver.stat.Bytes += int64(header.Size) - offset
+	receiver.stat.Resumed += offset
+	return receiver.reply(&packet.FileMessage{Ret: RetWithError(NoError)})
+}
+
+// resumeOffset 计算续传起点并将已有数据计入校验和,不续传时清空临时文件
+func (receiver *fileReceiver) resumeOffset(f *os.File, h hash.Hash, size int64) (int64, error) {
+	var offset int64
+	if receiver.resume {
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if info.Size() <= size {
+			offset = info.Size()
+		}
+	}
+	if _, err := io.CopyN(h, f, offset); err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		return 0, err
+	}
+	_, err := f.Seek(offset, io.SeekStart)
+	return offset, err
+}
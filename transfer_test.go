@@ -0,0 +1,196 @@
+package silly_ctrl
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/quic-go/quic-go"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// quicPair 在回环地址上建立一对 QUIC 连接,测试结束时关闭
+func quicPair(t *testing.T) (client, server quic.Connection) {
+	t.Helper()
+	cert, key, err := CreateCertificate(&CertRequest{CommonName: "localhost", Hosts: []string{"127.0.0.1"}, Server: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}, NextProtos: []string{"test"}}
+	quicConfig := &quic.Config{EnableDatagrams: true}
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverTLS, quicConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	client, err = quic.DialAddr(ctx, listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}, quicConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.CloseWithError(0, "")
+	})
+	if server, err = listener.Accept(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = server.CloseWithError(0, "")
+	})
+	return client, server
+}
+
+// transfer 经 QUIC stream 将 src 发送至 dest,返回双方的统计与错误
+func transfer(t *testing.T, src, dest string, resume bool) (sent, received *TransferStat, sendErr, recvErr error) {
+	t.Helper()
+	client, server := quicPair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	stream, err := client.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sent, sendErr = SendFiles(stream, src)
+		_ = stream.Close()
+	}()
+	peer, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, recvErr = ReceiveFiles(peer, dest, resume)
+	_ = peer.Close()
+	<-done
+	return sent, received, sendErr, recvErr
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTransferDirectory(t *testing.T) {
+	src, dest := filepath.Join(t.TempDir(), "data"), t.TempDir()
+	writeFiles(t, map[string]string{
+		filepath.Join(src, "a.txt"):         "alpha",
+		filepath.Join(src, "sub", "b.txt"):  strings.Repeat("b", 100000),
+		filepath.Join(src, "sub", "c", "d"): "",
+	})
+	sent, received, sendErr, recvErr := transfer(t, src, dest, false)
+	if sendErr != nil || recvErr != nil {
+		t.Fatalf("transfer() send %v, receive %v", sendErr, recvErr)
+	}
+	if sent.Files != 3 || received.Files != 3 || received.Dirs != 3 || received.Bytes != 100005 {
+		t.Fatalf("transfer() sent %+v, received %+v", sent, received)
+	}
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt"), filepath.Join("sub", "c", "d")} {
+		want, _ := os.ReadFile(filepath.Join(src, name))
+		// dest 为已存在的目录,写入其下的同名目录
+		got, err := os.ReadFile(filepath.Join(dest, "data", name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestTransferResume(t *testing.T) {
+	content := strings.Repeat("0123456789", 10000)
+	tests := []struct {
+		name    string
+		part    string // 接收方已有的 .part 文件内容
+		resume  bool
+		resumed int64
+		err     error
+	}{
+		{"resume", content[:40000], true, 40000, nil},
+		{"no resume", content[:40000], false, 0, nil},
+		{"part larger than file", content + "x", true, 0, nil},
+		{"corrupted part", strings.Repeat("x", 40000), true, 40000, ChecksumError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dest := filepath.Join(t.TempDir(), "file"), filepath.Join(t.TempDir(), "out")
+			writeFiles(t, map[string]string{src: content, dest + partSuffix: tt.part})
+			_, received, _, err := transfer(t, src, dest, tt.resume)
+			if (tt.err == nil && err != nil) || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("ReceiveFiles() = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && received.Resumed != tt.resumed {
+				t.Fatalf("Resumed = %d, want %d", received.Resumed, tt.resumed)
+			}
+			if tt.err != nil {
+				// 校验失败时删除临时文件,下次从头传输
+				if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+					t.Fatalf("part file after checksum error: %v", err)
+				}
+				return
+			}
+			if got, err := os.ReadFile(dest); err != nil || string(got) != content {
+				t.Fatalf("received %d bytes, %v, want %d", len(got), err, len(content))
+			}
+		})
+	}
+}
+
+func TestTransferSymlinkInDest(t *testing.T) {
+	src, dest, outside := filepath.Join(t.TempDir(), "data"), t.TempDir(), t.TempDir()
+	writeFiles(t, map[string]string{filepath.Join(src, "link", "file"): "payload"})
+	// 目标目录中已有指向外部的符号链接,不应经其写入
+	if err := os.MkdirAll(filepath.Join(dest, "data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dest, "data", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := transfer(t, src, dest, false); !errors.Is(err, PermissionDenied) {
+		t.Fatalf("ReceiveFiles() = %v, want %v", err, PermissionDenied)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("wrote %d entries outside dest", len(entries))
+	}
+}
+
+func TestNoSymlinkBelow(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "dir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(base, "link")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		target string
+		ok     bool
+	}{
+		{"base", base, true},
+		{"existing dir", filepath.Join(base, "dir", "file"), true},
+		{"missing", filepath.Join(base, "a", "b"), true},
+		{"symlink", filepath.Join(base, "link"), false},
+		{"below symlink", filepath.Join(base, "link", "file"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := noSymlinkBelow(base, tt.target)
+			if tt.ok != (err == nil) || (!tt.ok && !errors.Is(err, PermissionDenied)) {
+				t.Fatalf("noSymlinkBelow(%s) = %v, want ok %v", tt.target, err, tt.ok)
+			}
+		})
+	}
+}
@@ -2,13 +2,20 @@ package silly_ctrl
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/irealing/silly-ctrl/packet"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/protobuf/encoding/protodelim"
 	"google.golang.org/protobuf/proto"
 	"io"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
 )
 
 func RetWithError(e error) *packet.Ret {
@@ -27,6 +34,21 @@ func RetWithError(e error) *packet.Ret {
 	return r
 }
 
+// ErrorFromRet 将 Ret 转换为 error,保留对端返回的错误信息
+func ErrorFromRet(ret *packet.Ret) error {
+	if ret.GetErrNo() == NoError.Code() {
+		return nil
+	}
+	errNo := ErrorNo(ret.GetErrNo())
+	// 多跳转发时对端的错误信息已带有相同前缀
+	msg := strings.TrimPrefix(ret.GetMsg(), errNo.String()+": ")
+	if msg == "" || msg == errNo.String() {
+		return errNo
+	}
+	return fmt.Errorf("%w: %s", errNo, msg)
+}
+
+// CopyWithContext 将 src 复制到 dst,直到读写出错或 ctx 结束,dst 的写错误同样返回
 func CopyWithContext(ctx context.Context, src io.Reader, dst io.Writer) error {
 	buf := make([]byte, 1024*16)
 	for {
@@ -36,7 +58,7 @@ func CopyWithContext(ctx context.Context, src io.Reader, dst io.Writer) error {
 		default:
 			l, err := src.Read(buf)
 			if l > 0 {
-				if _, we := dst.Write(buf[:l]); err != nil {
+				if _, we := dst.Write(buf[:l]); we != nil {
 					return we
 				}
 			}
@@ -47,13 +69,98 @@ func CopyWithContext(ctx context.Context, src io.Reader, dst io.Writer) error {
 	}
 }
 
-func Forward(ctx context.Context, x, y io.ReadWriter) error {
+// WritePacket 以 2 字节长度前缀写入一个数据报,用于在 stream 上保留数据报边界
+func WritePacket(w io.Writer, p []byte) error {
+	if len(p) > math.MaxUint16 {
+		return io.ErrShortBuffer
+	}
+	buf := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(buf, uint16(len(p)))
+	copy(buf[2:], p)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadPacket 读取一个由 WritePacket 写入的数据报
+func ReadPacket(r io.Reader, buf []byte) (int, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(size[:]))
+	if n > len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+	return io.ReadFull(r, buf[:n])
+}
+
+// DefaultShell SHELL 命令未指定程序时使用的 shell
+func DefaultShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// CommandEnv EXEC/SHELL 的 env 参数,多个变量以 ; 分隔
+func CommandEnv(command *packet.Command) []string {
+	if env, ok := command.GetParam("env"); ok && env != "" {
+		return strings.Split(env, ";")
+	}
+	return nil
+}
+
+// SplitList 拆分以逗号分隔的列表,忽略空项
+func SplitList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// IsPacketNetwork 是否为面向数据报的网络类型
+func IsPacketNetwork(network string) bool {
+	return strings.HasPrefix(network, "udp")
+}
+
+// Forward 在 x 与 y 之间双向复制,字节数计入 app 的 ForwardedBytes
+func Forward(ctx context.Context, app string, x, y io.ReadWriter) error {
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
-		return CopyWithContext(ctx, x, y)
+		return CopyWithContext(ctx, x, CountingWriter(y, app, "stream"))
+	})
+	eg.Go(func() error {
+		return CopyWithContext(ctx, y, CountingWriter(x, app, "stream"))
+	})
+	return eg.Wait()
+}
+
+// RelayConn 在本地连接与 stream 之间双向转发,本地读结束时关闭 stream 写端,对端结束时关闭本地连接
+// 字节数计入 app 的 ForwardedBytes
+func RelayConn(ctx context.Context, app string, conn net.Conn, reader io.Reader, stream quic.Stream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+		stream.CancelRead(quic.StreamErrorCode(NoError))
+	}()
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		_, err := io.Copy(CountingWriter(stream, app, "stream"), reader)
+		_ = stream.Close()
+		if err != nil {
+			cancel()
+		}
+		return err
 	})
 	eg.Go(func() error {
-		return CopyWithContext(ctx, y, x)
+		defer cancel()
+		_, err := io.Copy(CountingWriter(conn, app, "stream"), stream)
+		return err
 	})
 	return eg.Wait()
 }
@@ -81,3 +188,53 @@ func DoQUICRequest[T, R proto.Message](ctx context.Context, msg T, ret R, conn q
 	}
 	return callback(ctx, ret, stream)
 }
+
+// FrameWriter 并发安全地向 stream 写入 Frame
+type FrameWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closed bool
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+func (fw *FrameWriter) Write(frame *packet.Frame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.closed {
+		return io.ErrClosedPipe
+	}
+	_, err := protodelim.MarshalTo(fw.w, frame)
+	return err
+}
+
+// Close 写入最后一个 Frame,此后的写入均返回 io.ErrClosedPipe
+func (fw *FrameWriter) Close(frame *packet.Frame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.closed {
+		return io.ErrClosedPipe
+	}
+	fw.closed = true
+	_, err := protodelim.MarshalTo(fw.w, frame)
+	return err
+}
+
+// Writer 返回将数据封装为指定类型 Frame 的 io.Writer
+func (fw *FrameWriter) Writer(t packet.FrameType) io.Writer {
+	return frameTypeWriter{fw: fw, t: t}
+}
+
+type frameTypeWriter struct {
+	fw *FrameWriter
+	t  packet.FrameType
+}
+
+func (w frameTypeWriter) Write(p []byte) (int, error) {
+	if err := w.fw.Write(&packet.Frame{Type: w.t, Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,62 @@
+package silly_ctrl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+type failWriter struct {
+	err error
+}
+
+func (w failWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestCopyWithContext(t *testing.T) {
+	writeErr := errors.New("write failed")
+	tests := []struct {
+		name string
+		dst  io.Writer
+		want error
+	}{
+		{"copy", &bytes.Buffer{}, io.EOF},
+		{"write error", failWriter{err: writeErr}, writeErr},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CopyWithContext(context.Background(), bytes.NewReader([]byte("payload")), tt.dst)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("CopyWithContext() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyWithContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := CopyWithContext(ctx, bytes.NewReader([]byte("payload")), &bytes.Buffer{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("CopyWithContext() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPacketFraming(t *testing.T) {
+	var buf bytes.Buffer
+	for _, p := range [][]byte{{}, []byte("a"), bytes.Repeat([]byte("x"), MaxDatagramSize+1)} {
+		if err := WritePacket(&buf, p); err != nil {
+			t.Fatalf("WritePacket(%d bytes) = %v", len(p), err)
+		}
+		out := make([]byte, MaxPacketSize)
+		n, err := ReadPacket(&buf, out)
+		if err != nil || !bytes.Equal(out[:n], p) {
+			t.Fatalf("ReadPacket() = %d, %v, want %d bytes", n, err, len(p))
+		}
+	}
+	if err := WritePacket(&buf, make([]byte, MaxPacketSize)); !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("WritePacket(oversize) = %v, want %v", err, io.ErrShortBuffer)
+	}
+}
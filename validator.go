@@ -0,0 +1,209 @@
+package silly_ctrl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/irealing/silly-ctrl/packet"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AppLookup 按 AccessKey 查询 App,不存在时返回 UnknownAppError
+type AppLookup func(ctx context.Context, accessKey string) (*App, error)
+
+type lookupValidator struct {
+	lookup  AppLookup
+	timeout time.Duration
+}
+
+// NewLookupValidator 经 lookup 查询 App 后在本地校验签名,查询失败返回 ValidatorUnavailable
+func NewLookupValidator(lookup AppLookup, timeout time.Duration) Validator {
+	return &lookupValidator{lookup: lookup, timeout: timeout}
+}
+
+func (v *lookupValidator) Validate(handshake *packet.Handshake, hctx *HandshakeContext) (*App, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+	app, err := v.lookup(ctx, handshake.AccessKey)
+	if errors.Is(err, UnknownAppError) {
+		return nil, UnknownAppError
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: lookup app %s: %s", ValidatorUnavailable, handshake.AccessKey, err)
+	}
+	return app, app.Verify(handshake, hctx)
+}
+
+type cachedApp struct {
+	app     *App
+	expires time.Time
+}
+
+// appCache 按 key 缓存 App,过期项每隔 ttl 清理一次
+type appCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	sweep   time.Time
+	entries map[string]*cachedApp
+}
+
+func newAppCache(ttl time.Duration) *appCache {
+	return &appCache{ttl: ttl, entries: make(map[string]*cachedApp)}
+}
+
+func (cache *appCache) Get(key string) (*App, bool) {
+	now := time.Now()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if now.After(cache.sweep) {
+		for k, entry := range cache.entries {
+			if now.After(entry.expires) {
+				delete(cache.entries, k)
+			}
+		}
+		cache.sweep = now.Add(cache.ttl)
+	}
+	entry, ok := cache.entries[key]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	return entry.app, true
+}
+
+func (cache *appCache) Put(key string, app *App) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries[key] = &cachedApp{app: app, expires: time.Now().Add(cache.ttl)}
+}
+
+// CachedLookup 缓存查询到的 App,App 不存在或查询出错时不缓存
+func CachedLookup(lookup AppLookup, ttl time.Duration) AppLookup {
+	cache := newAppCache(ttl)
+	return func(ctx context.Context, accessKey string) (*App, error) {
+		if app, ok := cache.Get(accessKey); ok {
+			return app, nil
+		}
+		app, err := lookup(ctx, accessKey)
+		if err != nil {
+			return nil, err
+		}
+		cache.Put(accessKey, app)
+		return app, nil
+	}
+}
+
+// SQLLookup 以 AccessKey 为唯一参数执行 query,结果为 Secret 与 JSON 格式的 Policy 两列,Policy 可为 NULL
+func SQLLookup(db *sql.DB, query string) AppLookup {
+	return func(ctx context.Context, accessKey string) (*App, error) {
+		var (
+			secret string
+			policy sql.NullString
+		)
+		err := db.QueryRowContext(ctx, query, accessKey).Scan(&secret, &policy)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, UnknownAppError
+		} else if err != nil {
+			return nil, err
+		}
+		app := &App{AccessKey: accessKey, Secret: secret}
+		if policy.Valid && policy.String != "" {
+			if err = json.Unmarshal([]byte(policy.String), &app.Policy); err != nil {
+				return nil, fmt.Errorf("bad policy of app %s: %w", accessKey, err)
+			}
+		}
+		return app, nil
+	}
+}
+
+// WebhookRequest 握手时 POST 至 webhook 的内容,Secret 仅由 webhook 持有并校验签名
+// V1: Sign = GenerateSignatureString(AccessKey, Secret, T),T 与当前时间相差不得超过 30 秒
+// V2: Sign = hex(ChallengeSignature(Secret, AccessKey, Nonce, Exporter)),Nonce 与 Exporter 为 base64
+type WebhookRequest struct {
+	AccessKey string `json:"access_key"`
+	Version   uint32 `json:"version"`
+	Sign      string `json:"sign"`
+	T         uint64 `json:"t,omitempty"`
+	Nonce     []byte `json:"nonce,omitempty"`
+	Exporter  []byte `json:"exporter,omitempty"`
+}
+
+// WebhookResponse webhook 的校验结果,状态码为 404 时视为 App 不存在,Allow 为 false 时视为签名错误
+// webhook 不可达、返回其他状态码或内容无法解析时返回 ValidatorUnavailable,客户端可重试
+type WebhookResponse struct {
+	Allow  bool    `json:"allow"`
+	Policy *Policy `json:"policy,omitempty"`
+}
+
+type webhookValidator struct {
+	client *http.Client
+	url    string
+	cache  *appCache
+}
+
+// NewWebhookValidator 将握手内容 POST 至 url,由 webhook 校验签名并返回 Policy
+// ttl 大于 0 时缓存允许的决定,键为 AccessKey 与客户端 TLS 证书的公钥指纹,TLS 握手已证明客户端持有对应私钥
+// 未提供客户端证书的握手签名每次不同且无法在本地校验,不缓存
+func NewWebhookValidator(client *http.Client, url string, ttl time.Duration) Validator {
+	v := &webhookValidator{client: client, url: url}
+	if ttl > 0 {
+		v.cache = newAppCache(ttl)
+	}
+	return v
+}
+
+// cacheKey 无缓存或无客户端证书时返回空
+func (v *webhookValidator) cacheKey(handshake *packet.Handshake, hctx *HandshakeContext) string {
+	if v.cache == nil || hctx == nil || len(hctx.PeerCertificates) < 1 {
+		return ""
+	}
+	return handshake.AccessKey + ":" + SPKIPin(hctx.PeerCertificates[0])
+}
+
+func (v *webhookValidator) Validate(handshake *packet.Handshake, hctx *HandshakeContext) (*App, error) {
+	msg := &WebhookRequest{AccessKey: handshake.AccessKey, Version: HandshakeV1, Sign: handshake.Sign, T: handshake.T}
+	if hctx != nil && hctx.Version == HandshakeCert {
+		return nil, fmt.Errorf("%w: certificate handshake requires a certificate validator", AuthError)
+	} else if hctx != nil && hctx.Version >= HandshakeV2 {
+		msg.Version, msg.T, msg.Nonce, msg.Exporter = hctx.Version, 0, hctx.Nonce, hctx.Exporter
+	}
+	key := v.cacheKey(handshake, hctx)
+	if key != "" {
+		if app, ok := v.cache.Get(key); ok {
+			return app, nil
+		}
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Post(v.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: webhook %s: %s", ValidatorUnavailable, handshake.AccessKey, err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, UnknownAppError
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: webhook %s: status %s", ValidatorUnavailable, handshake.AccessKey, resp.Status)
+	}
+	var ret WebhookResponse
+	if err = json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("%w: webhook %s: %s", ValidatorUnavailable, handshake.AccessKey, err)
+	}
+	if !ret.Allow {
+		return nil, HandshakeFailedError
+	}
+	app := &App{AccessKey: handshake.AccessKey, Policy: ret.Policy}
+	if key != "" {
+		v.cache.Put(key, app)
+	}
+	return app, nil
+}
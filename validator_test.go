@@ -0,0 +1,124 @@
+package silly_ctrl
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLookupValidatorErrors(t *testing.T) {
+	app := &App{AccessKey: "agent", Secret: "secret"}
+	tests := []struct {
+		name   string
+		lookup AppLookup
+		want   ErrorNo
+	}{
+		{"unknown app", func(context.Context, string) (*App, error) { return nil, UnknownAppError }, UnknownAppError},
+		{"backend down", func(context.Context, string) (*App, error) { return nil, errors.New("connection refused") }, ValidatorUnavailable},
+		{"wrong secret", func(context.Context, string) (*App, error) { return &App{AccessKey: "agent", Secret: "wrong"}, nil }, HandshakeFailedError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLookupValidator(tt.lookup, time.Second).Validate(app.Signature(), nil)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+			if IsAuthFailure(err) != (tt.want != ValidatorUnavailable) {
+				t.Fatalf("IsAuthFailure(%v) = %v", err, IsAuthFailure(err))
+			}
+		})
+	}
+}
+
+func TestWebhookValidatorErrors(t *testing.T) {
+	app := &App{AccessKey: "agent", Secret: "secret"}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    ErrorNo // NoError 表示允许
+	}{
+		{"allow", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(&WebhookResponse{Allow: true})
+		}, NoError},
+		{"deny", func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(&WebhookResponse{Allow: false})
+		}, HandshakeFailedError},
+		{"not found", func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}, UnknownAppError},
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", http.StatusBadGateway)
+		}, ValidatorUnavailable},
+		{"bad json", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("<html>"))
+		}, ValidatorUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			got, err := NewWebhookValidator(server.Client(), server.URL, 0).Validate(app.Signature(), nil)
+			if tt.want == NoError {
+				if err != nil || got == nil || got.AccessKey != app.AccessKey {
+					t.Fatalf("Validate() = %v, %v, want app %s", got, err, app.AccessKey)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	// webhook 不可达时可重试,不视为身份被拒
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	_, err := NewWebhookValidator(&http.Client{Timeout: time.Second}, url, 0).Validate(app.Signature(), nil)
+	if !errors.Is(err, ValidatorUnavailable) || IsAuthFailure(err) {
+		t.Fatalf("Validate() = %v, want retryable %v", err, ValidatorUnavailable)
+	}
+}
+
+func TestWebhookValidatorCache(t *testing.T) {
+	calls, allow := 0, true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_ = json.NewEncoder(w).Encode(&WebhookResponse{Allow: allow})
+	}))
+	defer server.Close()
+	certA, _, err := CreateCertificate(&CertRequest{CommonName: "a", Client: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certB, _, err := CreateCertificate(&CertRequest{CommonName: "b", Client: true, Validity: time.Hour}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{AccessKey: "agent", Secret: "secret"}
+	v := NewWebhookValidator(server.Client(), server.URL, time.Hour)
+	tests := []struct {
+		name  string
+		hctx  *HandshakeContext
+		allow bool
+		calls int // 校验后 webhook 累计被调用的次数
+	}{
+		{"no certificate", &HandshakeContext{Version: HandshakeV1}, true, 1},
+		{"no certificate again", &HandshakeContext{Version: HandshakeV1}, true, 2},
+		{"deny not cached", &HandshakeContext{Version: HandshakeV1, PeerCertificates: []*x509.Certificate{certA}}, false, 3},
+		{"allow cert a", &HandshakeContext{Version: HandshakeV1, PeerCertificates: []*x509.Certificate{certA}}, true, 4},
+		{"cached cert a", &HandshakeContext{Version: HandshakeV1, PeerCertificates: []*x509.Certificate{certA}}, true, 4},
+		{"other cert", &HandshakeContext{Version: HandshakeV1, PeerCertificates: []*x509.Certificate{certB}}, true, 5},
+	}
+	for _, tt := range tests {
+		allow = tt.allow
+		_, err := v.Validate(app.Signature(), tt.hctx)
+		if tt.allow != (err == nil) || calls != tt.calls {
+			t.Fatalf("%s: Validate() = %v, calls %d, want allow %v, calls %d", tt.name, err, calls, tt.allow, tt.calls)
+		}
+	}
+}